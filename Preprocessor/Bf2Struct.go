@@ -0,0 +1,363 @@
+package Preprocessor
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// PARSING AND CNF ENCODING OF BOOLEAN FORMULAS
+
+// Encoding is the way a boolean formula is translated into CNF.
+type Encoding byte
+
+const (
+	// Tseitin defines each subformula with a fresh var that is equivalent to it.
+	Tseitin = Encoding(iota)
+	// PlaistedGreenbaum only keeps the half of each definition that is needed
+	// given the polarity of the subformula, which yields about half the clauses.
+	PlaistedGreenbaum
+)
+
+// kind of a node of a formula.
+type bfKind byte
+
+const (
+	bfVar = bfKind(iota)
+	bfTrue
+	bfFalse
+	bfNot
+	bfAnd
+	bfOr
+	bfImplies
+	bfXor
+	bfEquiv
+)
+
+var bfOperators = map[string]bfKind{
+	"not":     bfNot,
+	"and":     bfAnd,
+	"or":      bfOr,
+	"implies": bfImplies,
+	"xor":     bfXor,
+	"equiv":   bfEquiv,
+}
+
+// a bfNode is a node of the syntax tree of a boolean formula.
+type bfNode struct {
+	kind     bfKind
+	name     string    // For vars, its name
+	children []*bfNode // For operators, its operands
+}
+
+// polarities in which a subformula appears.
+const (
+	polPos  = 1
+	polNeg  = 2
+	polBoth = polPos | polNeg
+)
+
+// ParseBF parses a file containing boolean formulas and returns the CNF encoding of their conjunction.
+// Formulas use a prefix syntax over named vars, e.g "and(a, or(b, not(c)), implies(a, xor(b, c)))".
+// Available operators are not (1 operand), implies (2 operands), and, or, xor, equiv (at least 1 operand),
+// as well as the constants true and false. Everything following a '#' on a line is a comment.
+// Named vars are numbered first, in order of appearance, and their names are kept in pb.Names.
+// They are frozen, so that they survive preprocessing. The vars introduced by the encoding come after them.
+// Like with ParseCNF, units and empty clauses are kept in pb.Clauses.
+func ParseBF(f io.Reader, enc Encoding) (*Problem, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read formula: %v", err)
+	}
+	p := bfParser{data: data, line: 1, vars: make(map[string]Var)}
+	var formulas []*bfNode
+	for p.skipSpaces(); p.pos < len(p.data); p.skipSpaces() {
+		node, err := p.parseFormula()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", p.line, err)
+		}
+		formulas = append(formulas, node)
+	}
+	pb := &Problem{NbVars: len(p.vars), Names: p.names}
+	e := bfEncoder{pb: pb, enc: enc, vars: p.vars}
+	for _, node := range formulas {
+		e.assert(node)
+	}
+	pb.Model = make([]decLevel, pb.NbVars)
+	for v := range p.names {
+		pb.Freeze(Var(v))
+	}
+	return pb, nil
+}
+
+// bfParser is a recursive descent parser for boolean formulas.
+type bfParser struct {
+	data  []byte
+	pos   int
+	line  int
+	vars  map[string]Var // Symbol table
+	names []string       // Name of each var, by index
+}
+
+func (p *bfParser) skipSpaces() {
+	for p.pos < len(p.data) {
+		b := p.data[p.pos]
+		if b == '#' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		} else if b == '\n' {
+			p.line++
+			p.pos++
+		} else if isSpace(b) {
+			p.pos++
+		} else {
+			return
+		}
+	}
+}
+
+func isIdentByte(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') ||
+		b == '_' || b == '.' || b == '[' || b == ']'
+}
+
+// ident reads an identifier, and returns "" if there is none.
+func (p *bfParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.data) && isIdentByte(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+func (p *bfParser) expect(b byte) error {
+	p.skipSpaces()
+	if p.pos >= len(p.data) {
+		return fmt.Errorf("expected %q, found EOF", b)
+	}
+	if p.data[p.pos] != b {
+		return fmt.Errorf("expected %q, found %q", b, p.data[p.pos])
+	}
+	p.pos++
+	return nil
+}
+
+func (p *bfParser) parseFormula() (*bfNode, error) {
+	p.skipSpaces()
+	name := p.ident()
+	if name == "" {
+		if p.pos >= len(p.data) {
+			return nil, fmt.Errorf("expected formula, found EOF")
+		}
+		return nil, fmt.Errorf("expected formula, found %q", p.data[p.pos])
+	}
+	switch name {
+	case "true":
+		return &bfNode{kind: bfTrue}, nil
+	case "false":
+		return &bfNode{kind: bfFalse}, nil
+	}
+	kind, isOp := bfOperators[name]
+	if p.skipSpaces(); !isOp || p.pos >= len(p.data) || p.data[p.pos] != '(' {
+		if isOp {
+			return nil, fmt.Errorf("%q is an operator and cannot be used as a var name", name)
+		}
+		if _, ok := p.vars[name]; !ok {
+			p.vars[name] = Var(len(p.names))
+			p.names = append(p.names, name)
+		}
+		return &bfNode{kind: bfVar, name: name}, nil
+	}
+	p.pos++ // Skip '('
+	node := &bfNode{kind: kind}
+	for {
+		child, err := p.parseFormula()
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, child)
+		if p.skipSpaces(); p.pos < len(p.data) && p.data[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		if err := p.expect(')'); err != nil {
+			return nil, err
+		}
+		break
+	}
+	switch {
+	case kind == bfNot && len(node.children) != 1:
+		return nil, fmt.Errorf("not expects 1 operand, got %d", len(node.children))
+	case kind == bfImplies && len(node.children) != 2:
+		return nil, fmt.Errorf("implies expects 2 operands, got %d", len(node.children))
+	}
+	return node, nil
+}
+
+// bfEncoder translates syntax trees into clauses.
+type bfEncoder struct {
+	pb      *Problem
+	enc     Encoding
+	vars    map[string]Var // Symbol table
+	trueLit *Lit           // Lit that is forced to true, used to encode constants.
+}
+
+// trueConst returns a lit that is forced to true.
+func (e *bfEncoder) trueConst() Lit {
+	if e.trueLit == nil {
+		lit := e.newVar()
+		e.addClause(lit)
+		e.trueLit = &lit
+	}
+	return *e.trueLit
+}
+
+// newVar returns the positive lit of a fresh var.
+func (e *bfEncoder) newVar() Lit {
+	v := Var(e.pb.NbVars)
+	e.pb.NbVars++
+	return v.Lit()
+}
+
+func (e *bfEncoder) addClause(lits ...Lit) {
+	e.pb.Clauses = append(e.pb.Clauses, NewClause(lits))
+}
+
+// assert adds clauses stating that node is true.
+// Top-level conjunctions are split and top-level disjunctions are directly added as clauses,
+// so that they don't need a definition.
+func (e *bfEncoder) assert(node *bfNode) {
+	switch node.kind {
+	case bfAnd:
+		for _, child := range node.children {
+			e.assert(child)
+		}
+	case bfOr:
+		e.addClause(e.encodeChildren(node.children, polPos)...)
+	default:
+		e.addClause(e.encode(node, polPos))
+	}
+}
+
+// encode returns a lit that is equivalent to node, defining it if needed.
+// pol are the polarities in which node appears, used by the Plaisted-Greenbaum encoding.
+func (e *bfEncoder) encode(node *bfNode, pol int) Lit {
+	if e.enc == Tseitin {
+		pol = polBoth
+	}
+	switch node.kind {
+	case bfVar:
+		return e.vars[node.name].Lit()
+	case bfTrue:
+		return e.trueConst()
+	case bfFalse:
+		return e.trueConst().Negation()
+	case bfNot:
+		return e.encode(node.children[0], flipPolarity(pol)).Negation()
+	case bfAnd:
+		return e.encodeAnd(e.encodeChildren(node.children, pol), pol)
+	case bfOr: // a | b = ~(~a & ~b)
+		lits := e.encodeChildren(node.children, pol)
+		for i := range lits {
+			lits[i] = lits[i].Negation()
+		}
+		return e.encodeAnd(lits, flipPolarity(pol)).Negation()
+	case bfImplies: // a -> b = ~(a & ~b)
+		a := e.encode(node.children[0], flipPolarity(pol))
+		b := e.encode(node.children[1], pol)
+		return e.encodeAnd([]Lit{a, b.Negation()}, flipPolarity(pol)).Negation()
+	case bfXor:
+		return e.encodeXors(e.encodeChildren(node.children, polBoth), pol)
+	case bfEquiv:
+		lits := e.encodeChildren(node.children, polBoth)
+		if len(lits) == 2 { // a <-> b = ~(a xor b)
+			return e.encodeXors(lits, flipPolarity(pol)).Negation()
+		}
+		return e.encodeAllEqual(lits, pol)
+	default:
+		panic("invalid node kind")
+	}
+}
+
+func flipPolarity(pol int) int {
+	res := 0
+	if pol&polPos != 0 {
+		res |= polNeg
+	}
+	if pol&polNeg != 0 {
+		res |= polPos
+	}
+	return res
+}
+
+func (e *bfEncoder) encodeChildren(children []*bfNode, pol int) []Lit {
+	lits := make([]Lit, len(children))
+	for i, child := range children {
+		lits[i] = e.encode(child, pol)
+	}
+	return lits
+}
+
+// encodeAnd returns a lit d equivalent to the conjunction of lits.
+func (e *bfEncoder) encodeAnd(lits []Lit, pol int) Lit {
+	if len(lits) == 1 {
+		return lits[0]
+	}
+	d := e.newVar()
+	if pol&polPos != 0 { // d -> l for all l
+		for _, lit := range lits {
+			e.addClause(d.Negation(), lit)
+		}
+	}
+	if pol&polNeg != 0 { // (l1 & ... & ln) -> d
+		clause := make([]Lit, 0, len(lits)+1)
+		for _, lit := range lits {
+			clause = append(clause, lit.Negation())
+		}
+		e.addClause(append(clause, d)...)
+	}
+	return d
+}
+
+// encodeXors returns a lit equivalent to the xor of all lits, as a chain of binary xors.
+func (e *bfEncoder) encodeXors(lits []Lit, pol int) Lit {
+	res := lits[0]
+	for i, lit := range lits[1:] {
+		if i == len(lits)-2 {
+			res = e.encodeXor(res, lit, pol)
+		} else { // Intermediate results appear in both polarities
+			res = e.encodeXor(res, lit, polBoth)
+		}
+	}
+	return res
+}
+
+// encodeXor returns a lit d equivalent to a xor b.
+func (e *bfEncoder) encodeXor(a, b Lit, pol int) Lit {
+	d := e.newVar()
+	if pol&polPos != 0 {
+		e.addClause(d.Negation(), a, b)
+		e.addClause(d.Negation(), a.Negation(), b.Negation())
+	}
+	if pol&polNeg != 0 {
+		e.addClause(d, a.Negation(), b)
+		e.addClause(d, a, b.Negation())
+	}
+	return d
+}
+
+// encodeAllEqual returns a lit d that is true iff all lits have the same value.
+func (e *bfEncoder) encodeAllEqual(lits []Lit, pol int) Lit {
+	if len(lits) == 1 {
+		return e.trueConst()
+	}
+	// all equal = (l1 & ... & ln) | (~l1 & ... & ~ln)
+	negs := make([]Lit, len(lits))
+	for i, lit := range lits {
+		negs[i] = lit.Negation()
+	}
+	allTrue := e.encodeAnd(lits, pol)
+	allFalse := e.encodeAnd(negs, pol)
+	return e.encodeAnd([]Lit{allTrue.Negation(), allFalse.Negation()}, flipPolarity(pol)).Negation()
+}
@@ -0,0 +1,21 @@
+package Preprocessor
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseBFNamedVars checks that named vars, and the clauses containing them, survive preprocessing.
+func TestParseBFNamedVars(t *testing.T) {
+	const want = "c var 1 a\nc var 2 b\nc var 3 c\nc var 4 d\np cnf 4 3\n1 2 0\n-1 3 0\n2 4 0\n"
+	for _, enc := range []Encoding{Tseitin, PlaistedGreenbaum} {
+		pb, err := ParseBF(strings.NewReader("and(or(a, b), or(not(a), c), or(b, d))"), enc)
+		if err != nil {
+			t.Fatalf("could not parse formula: %v", err)
+		}
+		pb.Preprocess()
+		if got := pb.CNF(); got != want {
+			t.Errorf("encoding %d: expected %q, got %q", enc, want, got)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package Preprocessor
+
+// BLOCKED CLAUSE ELIMINATION, INSPIRED BY http://fmv.jku.at/papers/JarvisaloBiereHeule-TACAS10.pdf
+// A clause c is blocked on one of its lits l if all its resolvents on l are tautologies, i.e if each clause
+// containing -l also contains the negation of another lit of c. Removing c doesn't change the satisfiability
+// of the problem: in a model falsifying c, l can be flipped, since all the clauses containing -l are satisfied
+// by another lit. That's why c is pushed on the stack with l as witness.
+// Lits are queued when they must be checked: at first all of them, then, each time a clause c is removed,
+// the negations of the other lits of c, since clauses containing them might have become blocked.
+// In a QBF, the blocking lit must be existential, and the tautologies must be on vars that are not quantified
+// after it.
+
+// blockable returns true iff a clause can be blocked on a lit of v.
+func (pb *Problem) blockable(v Var) bool {
+	return pb.Model[v] == 0 && !pb.isFrozen(v) && !pb.isUniversal(v)
+}
+
+// A blockedElim removes blocked clauses from a problem, using its occurrence lists.
+type blockedElim struct {
+	pb     *Problem
+	o      *occLists
+	marks  []bool // For each lit, true iff it is in the clause being checked
+	queue  []Lit  // Lits whose clauses must be checked
+	queued []bool // For each lit, true iff it is in the queue
+}
+
+// touch queues lit, unless it is already queued.
+func (b *blockedElim) touch(lit Lit) {
+	if !b.queued[lit] {
+		b.queued[lit] = true
+		b.queue = append(b.queue, lit)
+	}
+}
+
+// resolvable returns true iff a tautology on lit is allowed when checking whether a clause is blocked on blocking.
+func (b *blockedElim) resolvable(lit, blocking Lit) bool {
+	pb := b.pb
+	return !pb.QBF() || pb.qlevels[lit.Var()] <= pb.qlevels[blocking.Var()]
+}
+
+// blocked returns true iff c is blocked on lit. negs are the clauses containing the negation of lit.
+func (b *blockedElim) blocked(c *Clause, lit Lit, negs []*Clause) bool {
+	for _, lit2 := range c.lits {
+		b.marks[lit2] = true
+	}
+	blocked := true
+	for _, d := range negs {
+		if d.removed {
+			continue
+		}
+		taut := false
+		for _, lit2 := range d.lits {
+			if lit2 != lit.Negation() && b.marks[lit2.Negation()] && b.resolvable(lit2, lit) {
+				taut = true
+				break
+			}
+		}
+		if !taut {
+			blocked = false
+			break
+		}
+	}
+	for _, lit2 := range c.lits {
+		b.marks[lit2] = false
+	}
+	return blocked
+}
+
+// eliminateBlocked removes blocked clauses until no clause is blocked anymore, and returns the nb of removed clauses.
+func (pb *Problem) eliminateBlocked() int {
+	b := &blockedElim{
+		pb:     pb,
+		o:      pb.newOccLists(),
+		marks:  make([]bool, 2*pb.NbVars),
+		queued: make([]bool, 2*pb.NbVars),
+	}
+	for lit := Lit(2*pb.NbVars - 1); lit >= 0; lit-- { // The queue is a stack, so lits are checked in increasing order
+		b.touch(lit)
+	}
+	nb := 0
+	for len(b.queue) != 0 {
+		lit := b.queue[len(b.queue)-1]
+		b.queue = b.queue[:len(b.queue)-1]
+		b.queued[lit] = false
+		if !pb.blockable(lit.Var()) {
+			continue
+		}
+		negs := b.o.list(lit.Negation())
+		for _, c := range b.o.list(lit) {
+			if c.removed || !b.blocked(c, lit, negs) {
+				continue
+			}
+			pb.push(lit, c)
+			b.o.remove(c)
+			nb++
+			for _, lit2 := range c.lits {
+				if lit2 != lit {
+					b.touch(lit2.Negation())
+				}
+			}
+		}
+	}
+	pb.dropRemoved()
+	pb.Stats.Blocked += nb
+	return nb
+}
@@ -0,0 +1,768 @@
+package Preprocessor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PROOF CHECKING: DRAT PROOFS ARE CHECKED BACKWARDS, LRAT PROOFS FORWARDS, AND BOTH CAN BE TRIMMED.
+// A DRAT proof is first replayed up to the first empty clause, then lemmas are checked from the last one to the
+// first one, only if they were used to derive a lemma that was already checked. Unit propagation uses the clauses
+// that are already known to be useful before the other ones, so that the core and the trimmed proof stay small.
+// An LRAT proof gives, for each lemma, the clauses that are needed to check it, so it is checked in a single pass.
+// A proof that doesn't derive the empty clause is a derivation: all its lemmas are checked, but there is no core.
+
+// A ProofStep is the addition or the deletion of a clause in a proof.
+type ProofStep struct {
+	Deletion bool
+	ID       int   // In LRAT, ID of the added clause, or last ID before the deletion
+	Lits     []Lit // Lits of the clause. Empty for LRAT deletions
+	Hints    []int // In LRAT, hints of the added clause, or IDs of the deleted clauses
+	Line     int   // Line of the step, or number of the step in binary DRAT
+}
+
+// A ProofCheck is the result of a successful proof check.
+type ProofCheck struct {
+	Refutation bool        // True iff the proof derives the empty clause
+	Core       []int       // For a refutation, the indices, from 0, of the clauses of the formula that were needed
+	Trimmed    []ProofStep // For a refutation, the steps that were needed, meant to be checked against the core
+}
+
+// ParseProof reads a proof in the given format.
+func ParseProof(r io.Reader, format ProofFormat) ([]ProofStep, error) {
+	if format == BinaryDRAT {
+		return parseBinaryDRAT(bufio.NewReader(r))
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024*1024)
+	var steps []ProofStep
+	lineNb := 0
+	for sc.Scan() {
+		lineNb++
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || fields[0] == "c" {
+			continue
+		}
+		step := ProofStep{Line: lineNb}
+		if format == LRAT {
+			id, err := strconv.Atoi(fields[0])
+			if err != nil || id <= 0 {
+				return nil, fmt.Errorf("line %d: invalid clause ID %q", lineNb, fields[0])
+			}
+			step.ID = id
+			fields = fields[1:]
+		}
+		if len(fields) != 0 && fields[0] == "d" {
+			step.Deletion = true
+			fields = fields[1:]
+		}
+		nbs, rest, err := parseInts(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNb, err)
+		}
+		if format == LRAT {
+			if step.Deletion {
+				step.Hints = nbs
+			} else {
+				for _, n := range nbs {
+					step.Lits = append(step.Lits, IntToLit(int32(n)))
+				}
+				if step.Hints, rest, err = parseInts(rest); err != nil {
+					return nil, fmt.Errorf("line %d: %v", lineNb, err)
+				}
+			}
+		} else {
+			for _, n := range nbs {
+				step.Lits = append(step.Lits, IntToLit(int32(n)))
+			}
+		}
+		if len(rest) != 0 {
+			return nil, fmt.Errorf("line %d: unexpected %q after 0", lineNb, rest[0])
+		}
+		steps = append(steps, step)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("could not read proof: %v", err)
+	}
+	return steps, nil
+}
+
+// parseInts parses non-zero ints until a 0 is found, and returns them along with the fields after the 0.
+func parseInts(fields []string) (nbs []int, rest []string, err error) {
+	for i, field := range fields {
+		n, err := strconv.ParseInt(field, 10, 32)
+		if err != nil || n == -1<<31 {
+			return nil, nil, fmt.Errorf("invalid int %q", field)
+		}
+		if n == 0 {
+			return nbs, fields[i+1:], nil
+		}
+		nbs = append(nbs, int(n))
+	}
+	return nil, nil, fmt.Errorf("missing terminating 0")
+}
+
+// parseBinaryDRAT reads a binary DRAT proof.
+func parseBinaryDRAT(r *bufio.Reader) ([]ProofStep, error) {
+	var steps []ProofStep
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return steps, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read proof: %v", err)
+		}
+		step := ProofStep{Line: len(steps) + 1}
+		switch b {
+		case 'a':
+		case 'd':
+			step.Deletion = true
+		default:
+			return nil, fmt.Errorf("step %d: invalid byte %#x", step.Line, b)
+		}
+		for {
+			var u uint64
+			for shift := uint(0); ; shift += 7 {
+				b, err := r.ReadByte()
+				if err != nil {
+					return nil, fmt.Errorf("step %d: unfinished clause", step.Line)
+				}
+				if shift > 28 {
+					return nil, fmt.Errorf("step %d: literal too large", step.Line)
+				}
+				u |= uint64(b&127) << shift
+				if b < 128 {
+					break
+				}
+			}
+			if u == 0 {
+				break
+			}
+			if u < 2 {
+				return nil, fmt.Errorf("step %d: invalid literal", step.Line)
+			}
+			step.Lits = append(step.Lits, Lit(u-2))
+		}
+		steps = append(steps, step)
+	}
+}
+
+// WriteProof writes the given steps to w, in the given format.
+func WriteProof(w io.Writer, steps []ProofStep, format ProofFormat) error {
+	p := &proofWriter{Writer: bufio.NewWriterSize(w, 64*1024), format: format}
+	for _, step := range steps {
+		p.write(step.Deletion, step.ID, step.Lits, step.Hints)
+	}
+	return p.Flush()
+}
+
+// WriteCore writes the clauses of pb whose indices are in core as a DIMACS CNF.
+// Each clause is preceded by a "c clause <index>" comment giving its index, from 1, in pb.
+func (pb *Problem) WriteCore(w io.Writer, core []int) error {
+	fw := newFormulaWriter(w)
+	fw.header("cnf", pb.NbVars, len(core))
+	for _, i := range core {
+		fw.WriteString("c clause ")
+		fw.int(int64(i + 1))
+		fw.WriteByte('\n')
+		fw.lits(pb.Clauses[i].lits)
+	}
+	return fw.Flush()
+}
+
+// CheckProof checks that steps, read in the given format, is a valid proof for pb.
+// pb must be a CNF problem that was not modified since it was parsed.
+// An error is returned if a step is invalid.
+func (pb *Problem) CheckProof(steps []ProofStep, format ProofFormat) (*ProofCheck, error) {
+	if pb.QBF() || len(pb.Xors) != 0 {
+		return nil, fmt.Errorf("proofs can only be checked for CNF formulas")
+	}
+	for i, c := range pb.Clauses {
+		if c.Len() == 0 {
+			return &ProofCheck{Refutation: true, Core: []int{i}}, nil
+		}
+	}
+	if format == LRAT {
+		return pb.checkLRAT(steps)
+	}
+	return pb.checkDRAT(steps)
+}
+
+// A ckClause is a clause of the DRAT checker.
+type ckClause struct {
+	lits   []Lit // Lits without duplicates. The first two ones are watched
+	pivot  Lit   // First lit of the clause, as written in the proof
+	active bool  // Whether the clause is currently in the formula
+	core   bool  // Whether the clause is needed by a lemma that was checked
+	taut   bool  // Tautologies are never watched
+}
+
+// A dratChecker checks DRAT proofs with watched literals.
+type dratChecker struct {
+	clauses []ckClause
+	units   []int      // Indices of the unit clauses
+	watches [2][][]int // For each lit, indices of the clauses watching it: core clauses first, then other clauses
+	vals    []decLevel // For each var, its current binding
+	reasons []int      // For each var, index of the clause that propagated it, or -1 for assumptions
+	seen    []bool     // For each var, used during conflict analysis
+	trail   []Lit      // Lits that are true, in the order they were bound
+	// Positions in the trail of the next lits to propagate, with core clauses and with the other ones
+	headCore, head int
+}
+
+// litsKey returns a key identifying the clause made of lits, whatever the order of its lits.
+func litsKey(lits []Lit) string {
+	sorted := append([]Lit(nil), lits...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var buf []byte
+	for i, lit := range sorted {
+		if i == 0 || lit != sorted[i-1] {
+			buf = strconv.AppendInt(buf, int64(lit), 10)
+			buf = append(buf, ' ')
+		}
+	}
+	return string(buf)
+}
+
+// add adds a new active clause made of lits and returns its index.
+func (ck *dratChecker) add(lits []Lit) int {
+	idx := len(ck.clauses)
+	c := ckClause{active: true}
+	if len(lits) != 0 {
+		c.pivot = lits[0]
+	}
+	for _, lit := range lits {
+		dup := false
+		for _, lit2 := range c.lits {
+			if lit2 == lit {
+				dup = true
+			} else if lit2 == lit.Negation() {
+				c.taut = true
+			}
+		}
+		if !dup {
+			c.lits = append(c.lits, lit)
+		}
+	}
+	if !c.taut && len(c.lits) == 1 {
+		ck.units = append(ck.units, idx)
+	}
+	ck.clauses = append(ck.clauses, c)
+	return idx
+}
+
+// watch adds the clause at index idx to the watch lists of its first two lits, unless it is a tautology or a unit.
+func (ck *dratChecker) watch(idx int) {
+	c := &ck.clauses[idx]
+	if c.taut || len(c.lits) < 2 {
+		return
+	}
+	kind := 1
+	if c.core {
+		kind = 0
+	}
+	ck.watches[kind][c.lits[0]] = append(ck.watches[kind][c.lits[0]], idx)
+	ck.watches[kind][c.lits[1]] = append(ck.watches[kind][c.lits[1]], idx)
+}
+
+// value returns the binding of lit.
+func (ck *dratChecker) value(lit Lit) decLevel {
+	if lit.IsPositive() {
+		return ck.vals[lit.Var()]
+	}
+	return -ck.vals[lit.Var()]
+}
+
+// assign makes lit true, because of the clause at index reason.
+func (ck *dratChecker) assign(lit Lit, reason int) {
+	if lit.IsPositive() {
+		ck.vals[lit.Var()] = 1
+	} else {
+		ck.vals[lit.Var()] = -1
+	}
+	ck.reasons[lit.Var()] = reason
+	ck.trail = append(ck.trail, lit)
+}
+
+// propagate runs unit propagation, with core clauses first, and returns the index of a falsified clause, or -1.
+func (ck *dratChecker) propagate() int {
+	for {
+		if ck.headCore < len(ck.trail) {
+			ck.headCore++
+			if confl := ck.propagateLit(ck.trail[ck.headCore-1], 0); confl != -1 {
+				return confl
+			}
+		} else if ck.head < len(ck.trail) {
+			ck.head++
+			if confl := ck.propagateLit(ck.trail[ck.head-1], 1); confl != -1 {
+				return confl
+			}
+		} else {
+			return -1
+		}
+	}
+}
+
+// propagateLit visits the clauses of the given kind (0 for core clauses, 1 for the other ones)
+// that watch the negation of lit, and returns the index of a falsified clause, or -1.
+// Clauses that became core are moved to the core watch lists on the way, and inactive clauses,
+// i.e lemmas that were removed by the backward pass and will never be active again, are dropped.
+func (ck *dratChecker) propagateLit(lit Lit, kind int) int {
+	falseLit := lit.Negation()
+	ws := ck.watches[kind][falseLit]
+	j := 0
+	keep := func(idx int) {
+		if kind == 1 && ck.clauses[idx].core {
+			ck.watches[0][falseLit] = append(ck.watches[0][falseLit], idx)
+		} else {
+			ws[j] = idx
+			j++
+		}
+	}
+	for i, idx := range ws {
+		c := &ck.clauses[idx]
+		if !c.active {
+			continue
+		}
+		lits := c.lits
+		if lits[0] == falseLit {
+			lits[0], lits[1] = lits[1], lits[0]
+		}
+		if ck.value(lits[0]) == 1 {
+			keep(idx)
+			continue
+		}
+		found := false
+		for k := 2; k < len(lits); k++ {
+			if ck.value(lits[k]) != -1 {
+				lits[1], lits[k] = lits[k], lits[1]
+				newKind := 1
+				if c.core {
+					newKind = 0
+				}
+				ck.watches[newKind][lits[1]] = append(ck.watches[newKind][lits[1]], idx)
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		keep(idx)
+		if ck.value(lits[0]) == -1 {
+			for _, idx2 := range ws[i+1:] {
+				keep(idx2)
+			}
+			ck.watches[kind][falseLit] = ws[:j]
+			return idx
+		}
+		ck.assign(lits[0], idx)
+	}
+	ck.watches[kind][falseLit] = ws[:j]
+	return -1
+}
+
+// analyze marks as core the falsified clause at index confl and all the clauses that were used to falsify it.
+func (ck *dratChecker) analyze(confl int) {
+	ck.clauses[confl].core = true
+	for _, lit := range ck.clauses[confl].lits {
+		ck.seen[lit.Var()] = true
+	}
+	for i := len(ck.trail) - 1; i >= 0; i-- {
+		v := ck.trail[i].Var()
+		if !ck.seen[v] {
+			continue
+		}
+		ck.seen[v] = false
+		if r := ck.reasons[v]; r != -1 {
+			ck.clauses[r].core = true
+			for _, lit := range ck.clauses[r].lits {
+				if lit.Var() != v {
+					ck.seen[lit.Var()] = true
+				}
+			}
+		}
+	}
+}
+
+// rup returns true iff falsifying lits leads to a conflict by unit propagation on the active clauses.
+// The clauses that were needed to get the conflict are marked as core.
+// Unit clauses are only used when the lits alone don't lead to a conflict, since most lemmas don't need them.
+func (ck *dratChecker) rup(lits []Lit) bool {
+	for _, lit := range ck.trail {
+		ck.vals[lit.Var()] = 0
+	}
+	ck.trail = ck.trail[:0]
+	ck.headCore, ck.head = 0, 0
+	for _, lit := range lits {
+		switch ck.value(lit) {
+		case 1: // Tautology
+			return true
+		case 0:
+			ck.assign(lit.Negation(), -1)
+		}
+	}
+	if confl := ck.propagate(); confl != -1 {
+		ck.analyze(confl)
+		return true
+	}
+	for _, core := range []bool{true, false} {
+		for _, idx := range ck.units {
+			c := &ck.clauses[idx]
+			if !c.active || c.core != core {
+				continue
+			}
+			switch ck.value(c.lits[0]) {
+			case -1:
+				ck.analyze(idx)
+				return true
+			case 0:
+				ck.assign(c.lits[0], idx)
+			}
+		}
+		if confl := ck.propagate(); confl != -1 {
+			ck.analyze(confl)
+			return true
+		}
+	}
+	return false
+}
+
+// check returns true iff the clause at index idx is RUP or RAT on its pivot w.r.t the active clauses.
+func (ck *dratChecker) check(idx int) bool {
+	c := &ck.clauses[idx]
+	if c.taut || ck.rup(c.lits) {
+		return true
+	}
+	if len(c.lits) == 0 {
+		return false
+	}
+	notPivot := c.pivot.Negation()
+	var cands []int
+	for i := range ck.clauses {
+		if ck.clauses[i].active {
+			for _, lit := range ck.clauses[i].lits {
+				if lit == notPivot {
+					cands = append(cands, i)
+					break
+				}
+			}
+		}
+	}
+	var res []Lit
+	for _, i := range cands {
+		res = append(res[:0], ck.clauses[idx].lits...)
+		for _, lit := range ck.clauses[i].lits {
+			if lit != notPivot {
+				res = append(res, lit)
+			}
+		}
+		if !ck.rup(res) {
+			return false
+		}
+	}
+	for _, i := range cands {
+		ck.clauses[i].core = true
+	}
+	return true
+}
+
+// checkDRAT checks a DRAT proof backwards.
+func (pb *Problem) checkDRAT(steps []ProofStep) (*ProofCheck, error) {
+	nbVars := pb.NbVars
+	for _, step := range steps {
+		for _, lit := range step.Lits {
+			if int(lit.Var()) >= nbVars {
+				nbVars = int(lit.Var()) + 1
+			}
+		}
+	}
+	ck := &dratChecker{
+		vals:    make([]decLevel, nbVars),
+		reasons: make([]int, nbVars),
+		seen:    make([]bool, nbVars),
+	}
+	ck.watches[0] = make([][]int, 2*nbVars)
+	ck.watches[1] = make([][]int, 2*nbVars)
+	byKey := make(map[string][]int) // Indices of the active clauses, by key
+	for _, c := range pb.Clauses {
+		key := litsKey(c.lits)
+		byKey[key] = append(byKey[key], ck.add(append([]Lit(nil), c.lits...)))
+	}
+	// Forward pass: the proof is replayed up to the first empty clause
+	stepClauses := make([]int, len(steps)) // Index of the clause added or deleted by each step
+	last := len(steps) - 1
+	refutation := false
+	for i, step := range steps {
+		key := litsKey(step.Lits)
+		if step.Deletion {
+			idxs := byKey[key]
+			if len(idxs) == 0 {
+				return nil, fmt.Errorf("line %d: deleted clause not found", step.Line)
+			}
+			stepClauses[i] = idxs[len(idxs)-1]
+			byKey[key] = idxs[:len(idxs)-1]
+			ck.clauses[stepClauses[i]].active = false
+			continue
+		}
+		stepClauses[i] = ck.add(step.Lits)
+		byKey[key] = append(byKey[key], stepClauses[i])
+		if len(step.Lits) == 0 {
+			last = i
+			refutation = true
+			ck.clauses[stepClauses[i]].core = true
+			break
+		}
+	}
+	if !refutation { // All lemmas must be checked
+		for i := range ck.clauses[len(pb.Clauses):] {
+			ck.clauses[len(pb.Clauses)+i].core = true
+		}
+	}
+	// Backward pass: lemmas are removed one by one, and checked if they are core.
+	// Clauses are only watched from now on, so that deleted clauses are never visited.
+	for i, c := range ck.clauses {
+		if c.active {
+			ck.watch(i)
+		}
+	}
+	for i := last; i >= 0; i-- {
+		c := &ck.clauses[stepClauses[i]]
+		if steps[i].Deletion {
+			c.active = true
+			ck.watch(stepClauses[i])
+			continue
+		}
+		c.active = false
+		if c.core && !ck.check(stepClauses[i]) {
+			return nil, fmt.Errorf("line %d: lemma is neither RUP nor RAT", steps[i].Line)
+		}
+	}
+	res := &ProofCheck{Refutation: refutation}
+	if !refutation {
+		return res, nil
+	}
+	for i := range pb.Clauses {
+		if ck.clauses[i].core {
+			res.Core = append(res.Core, i)
+		}
+	}
+	for i, step := range steps[:last+1] {
+		if ck.clauses[stepClauses[i]].core && (step.Deletion || stepClauses[i] >= len(pb.Clauses)) {
+			res.Trimmed = append(res.Trimmed, step)
+		}
+	}
+	return res, nil
+}
+
+// An lratChecker checks LRAT proofs.
+// A hint is the ID of a clause that must become unit, or falsified, given the negation of the lemma
+// and the lits that were propagated by the previous hints. For a RAT lemma, each clause containing the negation
+// of the first lit of the lemma is given as a negative hint, followed by the hints of the corresponding resolvent.
+type lratChecker struct {
+	clauses map[int][]Lit    // Active clauses, by ID
+	vals    map[Var]decLevel // Current binding of the vars
+}
+
+// value returns the binding of lit.
+func (ck *lratChecker) value(lit Lit) decLevel {
+	if lit.IsPositive() {
+		return ck.vals[lit.Var()]
+	}
+	return -ck.vals[lit.Var()]
+}
+
+// assign makes lit true.
+func (ck *lratChecker) assign(lit Lit) {
+	if lit.IsPositive() {
+		ck.vals[lit.Var()] = 1
+	} else {
+		ck.vals[lit.Var()] = -1
+	}
+}
+
+// falsify makes all lits false, except skipped, and returns true iff one of them was already true.
+func (ck *lratChecker) falsify(lits []Lit, skipped Lit) (taut bool) {
+	for _, lit := range lits {
+		if lit == skipped {
+			continue
+		}
+		if ck.value(lit) == 1 {
+			taut = true
+		}
+		ck.assign(lit.Negation())
+	}
+	return taut
+}
+
+// chain propagates the clauses whose IDs are given as hints and returns true iff a conflict was reached.
+func (ck *lratChecker) chain(hints []int) (bool, error) {
+	for _, h := range hints {
+		lits, ok := ck.clauses[h]
+		if !ok {
+			return false, fmt.Errorf("unknown clause ID %d in hints", h)
+		}
+		var unit Lit
+		nbFree := 0
+		for _, lit := range lits {
+			switch ck.value(lit) {
+			case 1:
+				return false, fmt.Errorf("hint %d is satisfied", h)
+			case 0:
+				if nbFree == 0 || lit != unit {
+					nbFree++
+				}
+				unit = lit
+			}
+		}
+		if nbFree == 0 {
+			return true, nil
+		}
+		if nbFree > 1 {
+			return false, fmt.Errorf("hint %d is not unit", h)
+		}
+		ck.assign(unit)
+	}
+	return false, nil
+}
+
+// check checks that the clause made of lits is implied by the active clauses, given its hints.
+func (ck *lratChecker) check(lits []Lit, hints []int) error {
+	for v := range ck.vals {
+		delete(ck.vals, v)
+	}
+	if ck.falsify(lits, -1) {
+		return nil
+	}
+	n := 0
+	for n < len(hints) && hints[n] > 0 {
+		n++
+	}
+	if ok, err := ck.chain(hints[:n]); err != nil || ok {
+		return err
+	}
+	if len(lits) == 0 {
+		return fmt.Errorf("lemma is not RUP")
+	}
+	// RAT on the first lit: the propagated lits are kept for each resolvent.
+	// There are no RAT hints if no clause contains the negation of the pivot.
+	notPivot := lits[0].Negation()
+	base := make(map[Var]decLevel, len(ck.vals))
+	for v, val := range ck.vals {
+		base[v] = val
+	}
+	checked := make(map[int]bool)
+	for hints = hints[n:]; len(hints) != 0; hints = hints[n:] {
+		id := -hints[0]
+		for n = 1; n < len(hints) && hints[n] > 0; n++ {
+		}
+		res, ok := ck.clauses[id]
+		if !ok {
+			return fmt.Errorf("unknown clause ID %d in RAT hints", id)
+		}
+		checked[id] = true
+		if !ck.falsify(res, notPivot) {
+			if ok, err := ck.chain(hints[1:n]); err != nil {
+				return err
+			} else if !ok {
+				return fmt.Errorf("resolvent with clause %d is not RUP", id)
+			}
+		}
+		for v := range ck.vals {
+			delete(ck.vals, v)
+		}
+		for v, val := range base {
+			ck.vals[v] = val
+		}
+	}
+	for id, res := range ck.clauses {
+		for _, lit := range res {
+			if lit == notPivot && !checked[id] {
+				if len(checked) == 0 {
+					return fmt.Errorf("lemma is neither RUP nor RAT")
+				}
+				return fmt.Errorf("clause %d contains the negation of the pivot but has no hints", id)
+			}
+		}
+	}
+	return nil
+}
+
+// checkLRAT checks an LRAT proof. Clauses of the formula have IDs 1 to len(pb.Clauses).
+func (pb *Problem) checkLRAT(steps []ProofStep) (*ProofCheck, error) {
+	ck := &lratChecker{clauses: make(map[int][]Lit, len(pb.Clauses)), vals: make(map[Var]decLevel)}
+	for i, c := range pb.Clauses {
+		ck.clauses[i+1] = c.lits
+	}
+	lemmas := make(map[int]int) // Index of the step that added each lemma, by ID
+	lastID := len(pb.Clauses)
+	empty := -1 // ID of the empty clause
+	for i, step := range steps {
+		if step.Deletion {
+			for _, id := range step.Hints {
+				if _, ok := ck.clauses[id]; !ok {
+					return nil, fmt.Errorf("line %d: deleted clause %d not found", step.Line, id)
+				}
+				delete(ck.clauses, id)
+			}
+			continue
+		}
+		if step.ID <= lastID {
+			return nil, fmt.Errorf("line %d: clause ID %d is not greater than the previous IDs", step.Line, step.ID)
+		}
+		lastID = step.ID
+		if err := ck.check(step.Lits, step.Hints); err != nil {
+			return nil, fmt.Errorf("line %d: %v", step.Line, err)
+		}
+		ck.clauses[step.ID] = step.Lits
+		lemmas[step.ID] = i
+		if len(step.Lits) == 0 {
+			empty = step.ID
+			break
+		}
+	}
+	res := &ProofCheck{Refutation: empty != -1}
+	if !res.Refutation {
+		return res, nil
+	}
+	// Only the clauses that are reachable from the empty clause through hints are kept
+	needed := map[int]bool{empty: true}
+	for i := lemmas[empty]; i >= 0; i-- {
+		if step := steps[i]; !step.Deletion && needed[step.ID] {
+			for _, h := range step.Hints {
+				if h < 0 {
+					h = -h
+				}
+				needed[h] = true
+			}
+		}
+	}
+	newIDs := make(map[int]int) // New ID of each needed clause, so that the trimmed proof matches the core
+	for id := 1; id <= len(pb.Clauses); id++ {
+		if needed[id] {
+			res.Core = append(res.Core, id-1)
+			newIDs[id] = len(res.Core)
+		}
+	}
+	for _, step := range steps[:lemmas[empty]+1] {
+		if step.Deletion || !needed[step.ID] {
+			continue
+		}
+		newIDs[step.ID] = len(res.Core) + len(res.Trimmed) + 1
+		hints := make([]int, len(step.Hints))
+		for j, h := range step.Hints {
+			if h < 0 {
+				hints[j] = -newIDs[-h]
+			} else {
+				hints[j] = newIDs[h]
+			}
+		}
+		res.Trimmed = append(res.Trimmed, ProofStep{ID: newIDs[step.ID], Lits: step.Lits, Hints: hints, Line: step.Line})
+	}
+	return res, nil
+}
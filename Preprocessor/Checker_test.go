@@ -0,0 +1,128 @@
+package Preprocessor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// checkText checks the given proof of the given CNF formula.
+func checkText(t *testing.T, cnf, proof string, format ProofFormat) (*ProofCheck, error) {
+	t.Helper()
+	pb, err := ParseCNF(strings.NewReader(cnf))
+	if err != nil {
+		t.Fatalf("could not parse formula: %v", err)
+	}
+	steps, err := ParseProof(strings.NewReader(proof), format)
+	if err != nil {
+		t.Fatalf("could not parse proof: %v", err)
+	}
+	return pb.CheckProof(steps, format)
+}
+
+func TestCheckProof(t *testing.T) {
+	const (
+		unsat = "p cnf 2 4\n1 2 0\n-1 2 0\n1 -2 0\n-1 -2 0\n"
+		sat   = "p cnf 3 2\n1 2 0\n-2 3 0\n"
+	)
+	tests := []struct {
+		name       string
+		cnf        string
+		proof      string
+		format     ProofFormat
+		err        string // Expected error, or "" if the proof is valid
+		refutation bool
+	}{
+		{name: "RUP refutation", cnf: unsat, proof: "2 0\n0\n", format: DRAT, refutation: true},
+		{name: "RUP refutation with deletion", cnf: unsat, proof: "2 0\nd 1 2 0\nd -1 2 0\n0\n", format: DRAT, refutation: true},
+		{name: "RAT lemma", cnf: sat, proof: "1 -3 0\n", format: DRAT}, // Not RUP, but no clause contains -1
+		{name: "RAT lemma on a new var", cnf: sat, proof: "4 -1 0\n", format: DRAT},
+		{name: "invalid lemma", cnf: sat, proof: "-1 0\n", format: DRAT, err: "line 1: lemma is neither RUP nor RAT"},
+		{name: "invalid refutation", cnf: unsat, proof: "2 0\nd -1 -2 0\n0\n", format: DRAT, err: "line 3: lemma is neither RUP nor RAT"},
+		{name: "deletion of an absent clause", cnf: unsat, proof: "d 1 0\n", format: DRAT, err: "line 1: deleted clause not found"},
+		{name: "LRAT refutation", cnf: unsat, proof: "5 2 0 1 2 0\n6 0 5 3 4 0\n", format: LRAT, refutation: true},
+		{name: "LRAT RAT lemma", cnf: sat, proof: "3 1 -3 0 0\n", format: LRAT},
+		{name: "LRAT wrong hint", cnf: unsat, proof: "5 2 0 1 3 0\n", format: LRAT, err: "line 1: hint 3 is satisfied"},
+		{name: "LRAT missing hint", cnf: unsat, proof: "5 2 0 1 2 0\n6 0 5 3 0\n", format: LRAT, err: "line 2: lemma is not RUP"},
+		{name: "LRAT deleted hint", cnf: unsat, proof: "5 d 2 0\n6 2 0 1 2 0\n", format: LRAT, err: "line 2: unknown clause ID 2 in hints"},
+	}
+	for _, test := range tests {
+		res, err := checkText(t, test.cnf, test.proof, test.format)
+		if test.err != "" {
+			if err == nil {
+				t.Errorf("%s: invalid proof was accepted", test.name)
+			} else if err.Error() != test.err {
+				t.Errorf("%s: expected error %q, got %q", test.name, test.err, err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: valid proof was rejected: %v", test.name, err)
+		} else if res.Refutation != test.refutation {
+			t.Errorf("%s: expected refutation %v, got %v", test.name, test.refutation, res.Refutation)
+		}
+	}
+}
+
+// TestCheckProofTrimmed checks that the trimmed proof of an UNSAT instance is a valid refutation of its core.
+func TestCheckProofTrimmed(t *testing.T) {
+	data, err := ioutil.ReadFile("small.cnf")
+	if err != nil {
+		t.Fatalf("could not read instance: %v", err)
+	}
+	for _, format := range []ProofFormat{DRAT, BinaryDRAT, LRAT} {
+		pb, err := ParseCNF(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("could not parse instance: %v", err)
+		}
+		var proof bytes.Buffer
+		pb.SetProof(&proof, format)
+		pb.Preprocess()
+		if err := pb.FlushProof(); err != nil {
+			t.Fatalf("could not write proof: %v", err)
+		}
+		if pb.Status != Unsat {
+			t.Fatalf("expected UNSAT instance, got %v", pb.Status)
+		}
+		orig, _ := ParseCNF(bytes.NewReader(data))
+		steps, err := ParseProof(&proof, format)
+		if err != nil {
+			t.Fatalf("format %v: could not parse proof: %v", format, err)
+		}
+		res, err := orig.CheckProof(steps, format)
+		if err != nil {
+			t.Fatalf("format %v: proof was rejected: %v", format, err)
+		}
+		if !res.Refutation || len(res.Core) == 0 || len(res.Core) > len(orig.Clauses) || len(res.Trimmed) > len(steps) {
+			t.Fatalf("format %v: invalid check result: refutation %v, core %d/%d, trimmed %d/%d",
+				format, res.Refutation, len(res.Core), len(orig.Clauses), len(res.Trimmed), len(steps))
+		}
+		var coreText, trimText bytes.Buffer
+		if err := orig.WriteCore(&coreText, res.Core); err != nil {
+			t.Fatalf("format %v: could not write core: %v", format, err)
+		}
+		if err := WriteProof(&trimText, res.Trimmed, format); err != nil {
+			t.Fatalf("format %v: could not write trimmed proof: %v", format, err)
+		}
+		core, err := ParseCNF(&coreText)
+		if err != nil {
+			t.Fatalf("format %v: could not parse core: %v", format, err)
+		}
+		if len(core.Clauses) != len(res.Core) {
+			t.Errorf("format %v: core has %d clauses, expected %d", format, len(core.Clauses), len(res.Core))
+		}
+		trimmed, err := ParseProof(&trimText, format)
+		if err != nil {
+			t.Fatalf("format %v: could not parse trimmed proof: %v", format, err)
+		}
+		res2, err := core.CheckProof(trimmed, format)
+		if err != nil {
+			t.Fatalf("format %v: trimmed proof was rejected: %v", format, err)
+		}
+		if !res2.Refutation || len(res2.Core) != len(core.Clauses) {
+			t.Errorf("format %v: trimmed proof is not a refutation of the whole core: refutation %v, core %d/%d",
+				format, res2.Refutation, len(res2.Core), len(core.Clauses))
+		}
+	}
+}
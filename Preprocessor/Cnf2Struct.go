@@ -5,124 +5,329 @@ import (
 	"fmt"
 	"io"
 	"strconv"
-	"strings"
 )
 
-// COPIES OF GOPHERSAT'S PARSE FUNCTIONS FOR TESTING
+// PARSING OF DIMACS CNF FILES
 
+// ParseMode indicates how malformed DIMACS files are handled.
+type ParseMode byte
 
-func parseHeader(r *bufio.Reader) (nbVars, nbClauses int, err error) {
-	line, err := r.ReadString('\n')
-	if err != nil {
-		return 0, 0, fmt.Errorf("cannot read header: %v", err)
+const (
+	// Strict mode rejects any deviation from the DIMACS format.
+	Strict = ParseMode(iota)
+	// Lenient mode fixes what can be fixed and reports it as warnings:
+	// missing or wrong header, out-of-range literals, wrong nb of clauses, unfinished last clause.
+	Lenient
+)
+
+// A ParseError is an error (or a warning, in lenient mode) located in the parsed file.
+// Col is 0 when the error is about a whole line.
+type ParseError struct {
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	if e.Col == 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Col, e.Msg)
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// a token is a word from the file, with its position.
+type token struct {
+	text string
+	col  int // starts at 1
+}
+
+// tokenize splits line into space-separated tokens.
+func tokenize(line string) []token {
+	var toks []token
+	i := 0
+	for i < len(line) {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		start := i
+		for i < len(line) && !isSpace(line[i]) {
+			i++
+		}
+		if i > start {
+			toks = append(toks, token{text: line[start:i], col: start + 1})
+		}
+	}
+	return toks
+}
+
+// cnfParser holds the state of the parsing of a DIMACS file.
+type cnfParser struct {
+	mode       ParseMode
+	pb         *Problem
+	warnings   []*ParseError
+	lineNb     int
+	header     bool   // Was the header found yet?
+	headerLine int    // Line of the header
+	nbClauses  int    // Nb of clauses declared in the header
+	lits       []Lit  // Lits of the clause being parsed
+	clauseLine int    // Line where the clause being parsed started
+	quantified []bool // For QDIMACS files, the vars that already appeared in the prefix
+	noHeader   bool   // Was the lack of header reported yet?
+	varsGrown  bool   // Was a var beyond the nb of vars declared in the header reported yet?
+}
+
+// ParseCNF parses a CNF file in strict mode and returns the corresponding Problem.
+// The clauses are kept as they are in the file, including units and empty clauses, and the status is Undetermined:
+// unit propagation is left to Simplify2 or Preprocess, so that it can be written in a proof.
+func ParseCNF(f io.Reader) (*Problem, error) {
+	pb, _, err := ParseCNFMode(f, Strict)
+	return pb, err
+}
+
+// ParseCNFMode parses a CNF file and returns the corresponding Problem.
+// QDIMACS files are accepted too: their quantifier prefix is stored in pb.Prefix.
+// So are xor constraints, written as "x" lines: they are stored in pb.Xors.
+// In strict mode, the first problem found is returned as a *ParseError.
+// In lenient mode, the nb of vars and clauses are inferred from the clauses themselves
+// and problems are returned as warnings instead. A missing header, or a var beyond the declared nb of vars,
+// is only reported once.
+// Clauses are kept as they are in the file, like with ParseCNF.
+func ParseCNFMode(f io.Reader, mode ParseMode) (pb *Problem, warnings []*ParseError, err error) {
+	p := &cnfParser{mode: mode, pb: &Problem{}}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024*1024)
+	for sc.Scan() {
+		p.lineNb++
+		toks := tokenize(sc.Text())
+		if len(toks) == 0 {
+			continue
+		}
+		if toks[0].text[0] == '%' { // SATLIB end marker
+			break
+		}
+		if err := p.parseLine(toks); err != nil {
+			return nil, p.warnings, err
+		}
 	}
-	fields := strings.Fields(line)
-	if len(fields) < 3 {
-		return 0, 0, fmt.Errorf("invalid syntax %q in header", line)
+	if err := sc.Err(); err != nil {
+		return nil, p.warnings, fmt.Errorf("could not read CNF: %v", err)
 	}
-	nbVars, err = strconv.Atoi(fields[1])
-	if err != nil {
-		return 0, 0, fmt.Errorf("nbvars not an int : %q", fields[1])
+	if err := p.finish(); err != nil {
+		return nil, p.warnings, err
 	}
-	nbClauses, err = strconv.Atoi(fields[2])
-	if err != nil {
-		return 0, 0, fmt.Errorf("nbClauses not an int : '%s'", fields[2])
+	return p.pb, p.warnings, nil
+}
+
+// problem reports a problem at the given position.
+// It is an error in strict mode, a warning in lenient mode.
+func (p *cnfParser) problem(line, col int, format string, args ...interface{}) error {
+	err := &ParseError{Line: line, Col: col, Msg: fmt.Sprintf(format, args...)}
+	if p.mode == Strict {
+		return err
 	}
-	return nbVars, nbClauses, nil
+	p.warnings = append(p.warnings, err)
+	return nil
 }
 
-func isSpace(b byte) bool {
-	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+func (p *cnfParser) parseLine(toks []token) error {
+	switch toks[0].text[0] {
+	case 'c': // Ignore comment
+		return nil
+	case 'p':
+		return p.parseHeader(toks)
+	case 'a', 'e':
+		return p.parseQuant(toks)
+	case 'x':
+		return p.parseXor(toks)
+	default:
+		return p.parseClause(toks)
+	}
 }
 
-// readInt reads an int from r.
-// 'b' is the last read byte. It can be a space, a '-' or a digit.
-// The int can be negated.
-// All spaces before the int value are ignored.
-// Can return EOF.
-func readInt(b *byte, r *bufio.Reader) (res int, err error) {
-	for err == nil && isSpace(*b) {
-		*b, err = r.ReadByte()
+// parseHeader parses a "p cnf nbvars nbclauses" line.
+func (p *cnfParser) parseHeader(toks []token) error {
+	if p.header {
+		return &ParseError{Line: p.lineNb, Col: toks[0].col, Msg: fmt.Sprintf("duplicate header, first one was on line %d", p.headerLine)}
+	}
+	if len(p.pb.Clauses) != 0 || len(p.lits) != 0 {
+		if err := p.problem(p.lineNb, toks[0].col, "header found after clauses"); err != nil {
+			return err
+		}
 	}
-	if err == io.EOF {
-		return res, io.EOF
+	if toks[0].text != "p" || len(toks) != 4 || toks[1].text != "cnf" {
+		return &ParseError{Line: p.lineNb, Col: toks[0].col, Msg: "invalid header, expected \"p cnf <nbvars> <nbclauses>\""}
 	}
-	if err != nil {
-		return res, fmt.Errorf("could not read digit: %v", err)
+	nbVars, err := strconv.Atoi(toks[2].text)
+	if err != nil || nbVars < 0 {
+		return &ParseError{Line: p.lineNb, Col: toks[2].col, Msg: fmt.Sprintf("nbvars not a positive int : %q", toks[2].text)}
 	}
-	neg := 1
-	if *b == '-' {
-		neg = -1
-		*b, err = r.ReadByte()
+	nbClauses, err := strconv.Atoi(toks[3].text)
+	if err != nil || nbClauses < 0 {
+		return &ParseError{Line: p.lineNb, Col: toks[3].col, Msg: fmt.Sprintf("nbClauses not a positive int : %q", toks[3].text)}
+	}
+	p.header = true
+	p.headerLine = p.lineNb
+	p.nbClauses = nbClauses
+	if nbVars > p.pb.NbVars {
+		p.pb.NbVars = nbVars
+	}
+	if p.pb.Clauses == nil {
+		p.pb.Clauses = make([]*Clause, 0, nbClauses)
+	}
+	return nil
+}
+
+// parseQuant parses a line of the quantifier prefix of a QDIMACS file, i.e "a vars 0" or "e vars 0".
+func (p *cnfParser) parseQuant(toks []token) error {
+	if len(toks[0].text) != 1 {
+		return &ParseError{Line: p.lineNb, Col: toks[0].col, Msg: fmt.Sprintf("invalid quantifier %q", toks[0].text)}
+	}
+	if !p.header && !p.noHeader {
+		p.noHeader = true
+		if err := p.problem(p.lineNb, toks[0].col, "quantifier found before header"); err != nil {
+			return err
+		}
+	}
+	if len(p.pb.Clauses) != 0 || len(p.lits) != 0 {
+		if err := p.problem(p.lineNb, toks[0].col, "quantifier found after clauses"); err != nil {
+			return err
+		}
+	}
+	last := toks[len(toks)-1]
+	if last.text != "0" {
+		return &ParseError{Line: p.lineNb, Col: last.col, Msg: "quantifier block does not end with 0"}
+	}
+	vars := make([]Var, 0, len(toks)-2)
+	for _, tok := range toks[1 : len(toks)-1] {
+		val, err := p.parseLit(tok)
 		if err != nil {
-			return 0, fmt.Errorf("cannot read int: %v", err)
+			return err
+		}
+		if val <= 0 {
+			return &ParseError{Line: p.lineNb, Col: tok.col, Msg: fmt.Sprintf("invalid var %q in quantifier block", tok.text)}
+		}
+		v := IntToVar(int32(val))
+		for len(p.quantified) <= int(v) {
+			p.quantified = append(p.quantified, false)
+		}
+		if p.quantified[v] {
+			if err := p.problem(p.lineNb, tok.col, "var %d is quantified twice", val); err != nil {
+				return err
+			}
+			continue
 		}
+		p.quantified[v] = true
+		vars = append(vars, v)
 	}
-	for err == nil {
-		if *b < '0' || *b > '9' {
-			return 0, fmt.Errorf("cannot read int: %q is not a digit", *b)
+	p.pb.addQuantBlock(toks[0].text == "a", vars)
+	return nil
+}
+
+// parseXor parses a xor constraint, i.e a line "x1 -2 3 0" or "x 1 -2 3 0".
+// Unlike clauses, xor constraints cannot span several lines.
+func (p *cnfParser) parseXor(toks []token) error {
+	if len(p.lits) != 0 {
+		return &ParseError{Line: p.lineNb, Col: toks[0].col, Msg: "xor constraint found inside a clause"}
+	}
+	if toks[0].text == "x" {
+		toks = toks[1:]
+	} else {
+		toks[0] = token{text: toks[0].text[1:], col: toks[0].col + 1}
+	}
+	if len(toks) == 0 || toks[len(toks)-1].text != "0" {
+		return &ParseError{Line: p.lineNb, Col: 0, Msg: "xor constraint does not end with 0"}
+	}
+	lits := make([]Lit, 0, len(toks)-1)
+	for _, tok := range toks[:len(toks)-1] {
+		val, err := p.parseLit(tok)
+		if err != nil {
+			return err
 		}
-		res = 10*res + int(*b-'0')
-		*b, err = r.ReadByte()
-		if isSpace(*b) {
-			break
+		if val == 0 {
+			return &ParseError{Line: p.lineNb, Col: tok.col, Msg: "unexpected 0 inside xor constraint"}
 		}
+		lits = append(lits, IntToLit(int32(val)))
 	}
-	res *= neg
-	return res, err
+	p.pb.Xors = append(p.pb.Xors, NewXorClause(lits))
+	return nil
 }
 
-// ParseCNF parses a CNF file and returns the corresponding Problem.
-func ParseCNF(f io.Reader) (*Problem, error) {
-	r := bufio.NewReader(f)
-	var (
-		nbClauses int
-		pb        Problem
-	)
-	b, err := r.ReadByte()
-	for err == nil {
-		if b == 'c' { // Ignore comment
-			b, err = r.ReadByte()
-			for err == nil && b != '\n' {
-				b, err = r.ReadByte()
-			}
-		} else if b == 'p' { // Parse header
-			pb.NbVars, nbClauses, err = parseHeader(r)
-			if err != nil {
-				return nil, fmt.Errorf("cannot parse CNF header: %v", err)
+// parseLit parses a DIMACS literal, or a 0.
+func (p *cnfParser) parseLit(tok token) (int, error) {
+	val, err := strconv.ParseInt(tok.text, 10, 32)
+	if err != nil || val == -1<<31 {
+		return 0, &ParseError{Line: p.lineNb, Col: tok.col, Msg: fmt.Sprintf("invalid literal %q", tok.text)}
+	}
+	v := int(val)
+	if v > p.pb.NbVars || -v > p.pb.NbVars {
+		// Without a header, the nb of vars is always inferred, so that is not worth a warning
+		if !p.varsGrown && (p.header || p.mode == Strict) {
+			p.varsGrown = true
+			if err := p.problem(p.lineNb, tok.col, "invalid literal %d for problem with %d vars only", v, p.pb.NbVars); err != nil {
+				return 0, err
 			}
-			pb.Model = make([]decLevel, pb.NbVars)
-			pb.Clauses = make([]*Clause, 0, nbClauses)
+		}
+		if v < 0 {
+			p.pb.NbVars = -v
 		} else {
-			lits := make([]Lit, 0, 3) // Make room for some lits to improve performance
-			for {
-				val, err := readInt(&b, r)
-				fmt.Printf("Value: " + string(val))
-				if err == io.EOF {
-					if len(lits) != 0 { // This is not a trailing space at the end...
-						return nil, fmt.Errorf("unfinished clause while EOF found")
-					}
-					break // When there are only several useless spaces at the end of the file, that is ok
-				}
-				if err != nil {
-					return nil, fmt.Errorf("cannot parse clause: %v", err)
-				}
-				if val == 0 {
-					pb.Clauses = append(pb.Clauses, NewClause(lits))
-					break
-				} else {
-					if val > pb.NbVars || -val > pb.NbVars {
-						return nil, fmt.Errorf("invalid literal %d for problem with %d vars only", val, pb.NbVars)
-					}
-					lits = append(lits, IntToLit(int32(val)))
-				}
+			p.pb.NbVars = v
+		}
+	}
+	return v, nil
+}
+
+// parseClause parses lits until a 0 is found. A clause can span several lines.
+func (p *cnfParser) parseClause(toks []token) error {
+	if !p.header && !p.noHeader {
+		p.noHeader = true
+		if err := p.problem(p.lineNb, toks[0].col, "clause found before header"); err != nil {
+			return err
+		}
+	}
+	for _, tok := range toks {
+		val, err := p.parseLit(tok)
+		if err != nil {
+			return err
+		}
+		if len(p.lits) == 0 {
+			p.clauseLine = p.lineNb
+		}
+		if val == 0 {
+			p.pb.addClause(p.lits)
+			p.lits = make([]Lit, 0, 3) // Make room for some lits to improve performance
+		} else {
+			p.lits = append(p.lits, IntToLit(int32(val)))
+		}
+	}
+	return nil
+}
+
+// finish checks the problem is complete and allocates the model.
+func (p *cnfParser) finish() error {
+	if len(p.lits) != 0 {
+		if err := p.problem(p.clauseLine, 0, "unfinished clause while EOF found"); err != nil {
+			return err
+		}
+		p.pb.addClause(p.lits)
+	}
+	if !p.header {
+		if !p.noHeader {
+			if err := p.problem(p.lineNb, 0, "no header found"); err != nil {
+				return err
 			}
 		}
-		b, err = r.ReadByte()
+	} else if p.nbClauses != len(p.pb.Clauses)+len(p.pb.Xors) {
+		if err := p.problem(p.headerLine, 0, "header declares %d clauses, but %d were found", p.nbClauses, len(p.pb.Clauses)+len(p.pb.Xors)); err != nil {
+			return err
+		}
 	}
-	if err != io.EOF {
-		return nil, err
+	p.pb.Model = make([]decLevel, p.pb.NbVars)
+	if p.pb.QBF() {
+		p.pb.initQuantLevels()
 	}
-	pb.simplify2()
-	return &pb, nil
-}
\ No newline at end of file
+	return nil
+}
@@ -0,0 +1,180 @@
+package Preprocessor
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseCNFModeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     ParseMode
+		input    string
+		err      string   // Expected error, or "" if the file must be accepted
+		warnings []string // Expected warnings
+		nbVars   int      // If not 0, expected nb of vars
+	}{
+		{
+			name:  "bad literal, strict",
+			mode:  Strict,
+			input: "p cnf 3 2\n1 -2 0\n2  3x 0\n",
+			err:   `line 3, column 4: invalid literal "3x"`,
+		},
+		{
+			name:  "bad literal, lenient",
+			mode:  Lenient,
+			input: "p cnf 3 2\n1 -2 0\n2  3x 0\n",
+			err:   `line 3, column 4: invalid literal "3x"`,
+		},
+		{
+			name:  "out of range literal, strict",
+			mode:  Strict,
+			input: "p cnf 3 2\n1 -2 0\n2 -5 0\n",
+			err:   "line 3, column 3: invalid literal -5 for problem with 3 vars only",
+		},
+		{
+			name:     "out of range literal, lenient",
+			mode:     Lenient,
+			input:    "p cnf 3 2\n1 -2 0\n2 -5 0\n",
+			warnings: []string{"line 3, column 3: invalid literal -5 for problem with 3 vars only"},
+		},
+		{
+			name:  "wrong clause count, strict",
+			mode:  Strict,
+			input: "c comment\np cnf 3 3\n1 -2 0\n2 3 0\n",
+			err:   "line 2: header declares 3 clauses, but 2 were found",
+		},
+		{
+			name:     "wrong clause count, lenient",
+			mode:     Lenient,
+			input:    "c comment\np cnf 3 3\n1 -2 0\n2 3 0\n",
+			warnings: []string{"line 2: header declares 3 clauses, but 2 were found"},
+		},
+		{
+			name:  "missing header, strict",
+			mode:  Strict,
+			input: "c comment\n  1 -2 0\n2 3 0\n",
+			err:   "line 2, column 3: clause found before header",
+		},
+		{
+			name:     "missing header, lenient",
+			mode:     Lenient,
+			input:    "c comment\n  1 -2 0\n2 3 0\n",
+			warnings: []string{"line 2, column 3: clause found before header"},
+			nbVars:   3,
+		},
+		{
+			name:     "empty file, lenient",
+			mode:     Lenient,
+			input:    "c comment\n",
+			warnings: []string{"line 1: no header found"},
+		},
+		{
+			name:     "too many vars, lenient",
+			mode:     Lenient,
+			input:    "p cnf 2 3\n1 -3 0\n4 5 0\n-5 2 0\n",
+			warnings: []string{"line 2, column 3: invalid literal -3 for problem with 2 vars only"},
+			nbVars:   5,
+		},
+		{
+			name:  "unterminated clause, strict",
+			mode:  Strict,
+			input: "p cnf 3 2\n1 -2 0\n2\n3\n",
+			err:   "line 3: unfinished clause while EOF found",
+		},
+		{
+			name:     "unterminated clause, lenient",
+			mode:     Lenient,
+			input:    "p cnf 3 2\n1 -2 0\n2\n3\n",
+			warnings: []string{"line 3: unfinished clause while EOF found"},
+		},
+	}
+	for _, test := range tests {
+		pb, warnings, err := ParseCNFMode(strings.NewReader(test.input), test.mode)
+		if test.err != "" {
+			if err == nil {
+				t.Errorf("%s: expected error %q, got none", test.name, test.err)
+			} else if err.Error() != test.err {
+				t.Errorf("%s: expected error %q, got %q", test.name, test.err, err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %q", test.name, err.Error())
+			continue
+		}
+		if pb == nil {
+			t.Errorf("%s: no problem returned", test.name)
+		} else if test.nbVars != 0 && pb.NbVars != test.nbVars {
+			t.Errorf("%s: expected %d vars, got %d", test.name, test.nbVars, pb.NbVars)
+		}
+		var got []string
+		for _, w := range warnings {
+			got = append(got, w.Error())
+		}
+		if strings.Join(got, "\n") != strings.Join(test.warnings, "\n") {
+			t.Errorf("%s: expected warnings %q, got %q", test.name, test.warnings, got)
+		}
+	}
+}
+
+func TestParseKeepsUnitsAndEmptyClauses(t *testing.T) {
+	tests := []struct {
+		name   string
+		parse  func(input string) (*Problem, error)
+		input  string
+		sizes  []int  // Expected sizes of the parsed clauses
+		status Status // Expected status after Simplify2
+	}{
+		{
+			name:   "cnf",
+			parse:  func(input string) (*Problem, error) { return ParseCNF(strings.NewReader(input)) },
+			input:  "p cnf 2 3\n1 0\n-1 2 0\n0\n",
+			sizes:  []int{1, 2, 0},
+			status: Unsat,
+		},
+		{
+			name:   "cnf, units only",
+			parse:  func(input string) (*Problem, error) { return ParseCNF(strings.NewReader(input)) },
+			input:  "p cnf 2 2\n1 0\n-2 0\n",
+			sizes:  []int{1, 1},
+			status: Sat,
+		},
+		{
+			name:   "wcnf",
+			parse:  func(input string) (*Problem, error) { return ParseWCNF(strings.NewReader(input)) },
+			input:  "p wcnf 2 3 10\n10 1 0\n10 -1 2 0\n10 0\n",
+			sizes:  []int{1, 2, 0},
+			status: Unsat,
+		},
+		{
+			name:   "bf",
+			parse:  func(input string) (*Problem, error) { return ParseBF(strings.NewReader(input), Tseitin) },
+			input:  "a\nnot(a)\n",
+			sizes:  []int{1, 1},
+			status: Unsat,
+		},
+	}
+	for _, test := range tests {
+		pb, err := test.parse(test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error %q", test.name, err.Error())
+			continue
+		}
+		if pb.Status != Undetermined {
+			t.Errorf("%s: expected status %v after parsing, got %v", test.name, Undetermined, pb.Status)
+		}
+		var sizes []int
+		for _, c := range pb.Clauses {
+			sizes = append(sizes, c.Len())
+		}
+		if fmt.Sprint(sizes) != fmt.Sprint(test.sizes) {
+			t.Errorf("%s: expected clauses of sizes %v, got %v", test.name, test.sizes, sizes)
+		}
+		pb.Simplify2()
+		if pb.Status != test.status {
+			t.Errorf("%s: expected status %v after Simplify2, got %v", test.name, test.status, pb.Status)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package Preprocessor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// VAR COMPACTION: DENSE RENUMBERING OF THE VARS THAT SURVIVED PREPROCESSING, AND ITS INVERSE
+
+// A VarMap maps the vars of a compacted problem back to the vars of the original problem.
+// It is written as comments, either in a sidecar file or at the beginning of the compacted problem:
+//
+//	c compact <nb of original vars>
+//	c map <new var> <original var>
+//	c fixed <original lit>
+type VarMap struct {
+	NbVars int   // Nb of vars of the original problem
+	Vars   []Var // For each var of the compacted problem, the corresponding original var
+	Fixed  []Lit // Original lits that were true and removed from the problem
+}
+
+// Compact renumbers the vars of pb so that they are numbered from 1 to pb.NbVars without gaps,
+// and returns the map from the new vars to the original ones.
+// Only vars that appear in a clause, a xor constraint or the cost function are kept. Units on
+// other vars are removed from the problem and recorded in the map, except for QBFs where
+// units are kept, since a unit on a universal var is not a mere assignment.
+// The renumbering is monotone, so the order of vars in the quantifier prefix and in xors is preserved.
+func (pb *Problem) Compact() *VarMap {
+	vm := &VarMap{NbVars: pb.NbVars}
+	if pb.Status != Unsat {
+		pb.Simplify2() // Clauses must not contain fixed vars anymore
+	}
+	if pb.Status == Unsat {
+		pb.NbVars = 0
+		pb.Clauses, pb.Units, pb.Xors, pb.Names, pb.minLits, pb.minWeights = nil, nil, nil, nil, nil, nil
+		pb.Model, pb.frozen = nil, nil
+		if pb.QBF() {
+			pb.Prefix = []QuantBlock{}
+			pb.initQuantLevels()
+		}
+		return vm
+	}
+	used := make([]bool, pb.NbVars)
+	for _, c := range pb.Clauses {
+		for _, lit := range c.lits {
+			used[lit.Var()] = true
+		}
+	}
+	for _, x := range pb.Xors {
+		for _, v := range x.vars {
+			used[v] = true
+		}
+	}
+	for _, lit := range pb.minLits {
+		used[lit.Var()] = true
+	}
+	if pb.QBF() {
+		for _, unit := range pb.Units {
+			used[unit.Var()] = true
+		}
+	}
+	newVars := make([]Var, pb.NbVars) // -1 for removed vars
+	for i := range newVars {
+		if used[i] {
+			newVars[i] = Var(len(vm.Vars))
+			vm.Vars = append(vm.Vars, Var(i))
+		} else {
+			newVars[i] = -1
+		}
+	}
+	rename := func(lit Lit) Lit {
+		newLit := newVars[lit.Var()].Lit()
+		if !lit.IsPositive() {
+			newLit = newLit.Negation()
+		}
+		return newLit
+	}
+	for _, c := range pb.Clauses {
+		for i, lit := range c.lits {
+			c.lits[i] = rename(lit)
+		}
+	}
+	units := pb.Units[:0]
+	for _, unit := range pb.Units {
+		if used[unit.Var()] {
+			units = append(units, rename(unit))
+		} else {
+			vm.Fixed = append(vm.Fixed, unit)
+		}
+	}
+	pb.Units = units
+	for _, x := range pb.Xors {
+		for i, v := range x.vars {
+			x.vars[i] = newVars[v]
+		}
+	}
+	for i, lit := range pb.minLits {
+		pb.minLits[i] = rename(lit)
+	}
+	nbVars := len(vm.Vars)
+	pb.NbVars = nbVars
+	model := make([]decLevel, nbVars)
+	for i, v := range vm.Vars {
+		model[i] = pb.Model[v]
+	}
+	pb.Model = model
+	if pb.frozen != nil {
+		frozen := make([]bool, nbVars)
+		for i, v := range vm.Vars {
+			frozen[i] = pb.frozen[v]
+		}
+		pb.frozen = frozen
+	}
+	if pb.Names != nil {
+		var names []string
+		for i, v := range vm.Vars {
+			if int(v) < len(pb.Names) && pb.Names[v] != "" {
+				for len(names) < i {
+					names = append(names, "")
+				}
+				names = append(names, pb.Names[v])
+			}
+		}
+		pb.Names = names
+	}
+	if pb.QBF() {
+		prefix := pb.Prefix
+		pb.Prefix = []QuantBlock{}
+		for _, block := range prefix {
+			var vars []Var
+			for _, v := range block.Vars {
+				if used[v] {
+					vars = append(vars, newVars[v])
+				}
+			}
+			if len(vars) != 0 {
+				pb.addQuantBlock(block.Universal, vars)
+			}
+		}
+		pb.initQuantLevels()
+	}
+	return vm
+}
+
+// Write writes the map to w, as DIMACS comments.
+func (vm *VarMap) Write(w io.Writer) error {
+	fw := newFormulaWriter(w)
+	fw.WriteString("c compact ")
+	fw.int(int64(vm.NbVars))
+	fw.WriteByte('\n')
+	for i, v := range vm.Vars {
+		fw.WriteString("c map ")
+		fw.int(int64(Var(i).Lit().Int()))
+		fw.WriteByte(' ')
+		fw.int(int64(v.Lit().Int()))
+		fw.WriteByte('\n')
+	}
+	for _, lit := range vm.Fixed {
+		fw.WriteString("c fixed ")
+		fw.int(int64(lit.Int()))
+		fw.WriteByte('\n')
+	}
+	return fw.Flush()
+}
+
+// ParseVarMap reads a map written by VarMap.Write.
+// Lines that are not part of the map are ignored, so the map can be read directly from a compacted problem.
+func ParseVarMap(f io.Reader) (*VarMap, error) {
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024*1024)
+	var (
+		vm     *VarMap
+		lineNb = 0
+	)
+	for sc.Scan() {
+		lineNb++
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 || fields[0] != "c" || (fields[1] != "compact" && fields[1] != "map" && fields[1] != "fixed") {
+			continue
+		}
+		nbs := make([]int, len(fields)-2)
+		for i, field := range fields[2:] {
+			n, err := strconv.ParseInt(field, 10, 32)
+			if err != nil || n == -1<<31 {
+				return nil, fmt.Errorf("line %d: invalid int %q", lineNb, field)
+			}
+			nbs[i] = int(n)
+		}
+		switch fields[1] {
+		case "compact":
+			if vm != nil {
+				return nil, fmt.Errorf("line %d: duplicate map header", lineNb)
+			}
+			if len(nbs) != 1 || nbs[0] < 0 {
+				return nil, fmt.Errorf("line %d: invalid map header", lineNb)
+			}
+			vm = &VarMap{NbVars: nbs[0]}
+		case "map":
+			if vm == nil {
+				return nil, fmt.Errorf("line %d: map found before header", lineNb)
+			}
+			if len(nbs) != 2 || nbs[0] != len(vm.Vars)+1 || nbs[1] <= 0 || nbs[1] > vm.NbVars {
+				return nil, fmt.Errorf("line %d: invalid map line", lineNb)
+			}
+			vm.Vars = append(vm.Vars, IntToVar(int32(nbs[1])))
+		case "fixed":
+			if vm == nil {
+				return nil, fmt.Errorf("line %d: fixed lit found before header", lineNb)
+			}
+			if len(nbs) != 1 || nbs[0] == 0 || nbs[0] > vm.NbVars || -nbs[0] > vm.NbVars {
+				return nil, fmt.Errorf("line %d: invalid fixed lit", lineNb)
+			}
+			vm.Fixed = append(vm.Fixed, IntToLit(int32(nbs[0])))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("could not read map: %v", err)
+	}
+	if vm == nil {
+		return nil, fmt.Errorf("no map found")
+	}
+	return vm, nil
+}
+
+// Uncompact maps a model of the compacted problem back to the original vars.
+// The result has one lit per original var. Fixed vars get their fixed value, and vars that
+// were removed without being fixed, i.e that didn't appear in the problem anymore, are set to false.
+func (vm *VarMap) Uncompact(model []Lit) ([]Lit, error) {
+	values := make([]decLevel, vm.NbVars)
+	for _, lit := range vm.Fixed {
+		if lit.IsPositive() {
+			values[lit.Var()] = 1
+		} else {
+			values[lit.Var()] = -1
+		}
+	}
+	for _, lit := range model {
+		if int(lit.Var()) >= len(vm.Vars) {
+			return nil, fmt.Errorf("invalid var %d in model of a problem with %d vars", lit.Var().Lit().Int(), len(vm.Vars))
+		}
+		if lit.IsPositive() {
+			values[vm.Vars[lit.Var()]] = 1
+		} else {
+			values[vm.Vars[lit.Var()]] = -1
+		}
+	}
+	res := make([]Lit, vm.NbVars)
+	for i, val := range values {
+		res[i] = Var(i).Lit()
+		if val != 1 {
+			res[i] = res[i].Negation()
+		}
+	}
+	return res, nil
+}
+
+// ParseModel reads the output of a SAT solver, i.e an optional "s" status line and "v" lines
+// listing the lits of the model, terminated by a 0.
+// Lines without a "v" prefix are also accepted as lists of lits, other lines are ignored.
+// The returned status is Sat if the model was found, Unsat if the solver said so, and Undetermined otherwise.
+func ParseModel(f io.Reader) (status Status, model []Lit, err error) {
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024*1024)
+	lineNb := 0
+	found := false
+	for sc.Scan() {
+		lineNb++
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "s":
+			if len(fields) == 2 && fields[1] == "UNSATISFIABLE" {
+				return Unsat, nil, nil
+			}
+			continue
+		case "UNSAT": // MiniSat's output format
+			return Unsat, nil, nil
+		case "v":
+			fields = fields[1:]
+		default:
+			if _, err := strconv.Atoi(fields[0]); err != nil { // Comments and other solver messages
+				continue
+			}
+		}
+		for _, field := range fields {
+			val, err := strconv.ParseInt(field, 10, 32)
+			if err != nil || val == -1<<31 {
+				return Undetermined, nil, fmt.Errorf("line %d: invalid literal %q", lineNb, field)
+			}
+			if val == 0 {
+				found = true
+				break
+			}
+			model = append(model, IntToLit(int32(val)))
+		}
+		if found {
+			break
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return Undetermined, nil, fmt.Errorf("could not read model: %v", err)
+	}
+	if !found && len(model) == 0 {
+		return Undetermined, nil, nil
+	}
+	return Sat, model, nil
+}
+
+// WriteModel writes the given status, and the model if the status is Sat, in the SAT competition format.
+func WriteModel(w io.Writer, status Status, model []Lit) error {
+	fw := newFormulaWriter(w)
+	switch status {
+	case Sat:
+		fw.WriteString("s SATISFIABLE\n")
+		for i := 0; i < len(model); i += 10 {
+			end := i + 10
+			if end > len(model) {
+				end = len(model)
+			}
+			fw.WriteByte('v')
+			for _, lit := range model[i:end] {
+				fw.WriteByte(' ')
+				fw.int(int64(lit.Int()))
+			}
+			fw.WriteByte('\n')
+		}
+		fw.WriteString("v 0\n")
+	case Unsat:
+		fw.WriteString("s UNSATISFIABLE\n")
+	default:
+		fw.WriteString("s UNKNOWN\n")
+	}
+	return fw.Flush()
+}
@@ -0,0 +1,249 @@
+package Preprocessor
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+)
+
+// TRANSPARENT (DE)COMPRESSION OF INPUT AND OUTPUT FILES
+
+// Compression is a compression format for input or output files.
+type Compression byte
+
+const (
+	// NoCompression means the data is not compressed.
+	NoCompression = Compression(iota)
+	// Gzip is the .gz format.
+	Gzip
+	// Bzip2 is the .bz2 format.
+	Bzip2
+	// Xz is the .xz format.
+	Xz
+	// Lzma is the legacy .lzma format.
+	Lzma
+)
+
+// magic bytes at the beginning of compressed files.
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	lzmaMagic  = []byte{0x5d, 0x00, 0x00}
+)
+
+// extension of each compression format.
+var compressionExts = map[Compression]string{
+	Gzip:  ".gz",
+	Bzip2: ".bz2",
+	Xz:    ".xz",
+	Lzma:  ".lzma",
+}
+
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case Gzip:
+		return "gzip"
+	case Bzip2:
+		return "bzip2"
+	case Xz:
+		return "xz"
+	case Lzma:
+		return "lzma"
+	default:
+		panic("invalid compression")
+	}
+}
+
+// Ext returns the file extension of the compression format, e.g ".gz", or "" if there is no compression.
+func (c Compression) Ext() string {
+	return compressionExts[c]
+}
+
+// DetectCompression returns the compression format of data, given its first bytes.
+func DetectCompression(header []byte) Compression {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return Gzip
+	case bytes.HasPrefix(header, bzip2Magic):
+		return Bzip2
+	case bytes.HasPrefix(header, xzMagic):
+		return Xz
+	case bytes.HasPrefix(header, lzmaMagic):
+		return Lzma
+	default:
+		return NoCompression
+	}
+}
+
+// CompressionFromPath returns the compression format implied by the extension of path.
+func CompressionFromPath(path string) Compression {
+	for c, ext := range compressionExts {
+		if strings.HasSuffix(path, ext) {
+			return c
+		}
+	}
+	return NoCompression
+}
+
+// ParseCompression returns the compression format with the given name or extension, e.g "gz" or "gzip".
+func ParseCompression(name string) (Compression, error) {
+	name = strings.TrimPrefix(name, ".")
+	for c, ext := range compressionExts {
+		if name == c.String() || "."+name == ext {
+			return c, nil
+		}
+	}
+	if name == "" || name == "none" {
+		return NoCompression, nil
+	}
+	return NoCompression, fmt.Errorf("unknown compression format %q", name)
+}
+
+// TrimCompressionExt removes the compression extension of path, if any,
+// so that the format of the file can be deduced from the remaining extension.
+func TrimCompressionExt(path string) string {
+	if c := CompressionFromPath(path); c != NoCompression {
+		return strings.TrimSuffix(path, compressionExts[c])
+	}
+	return path
+}
+
+// NewReader returns a reader that decompresses r on the fly.
+// The compression format is detected from the first bytes of r, not from the name of the file,
+// and uncompressed data is returned as is.
+// gzip and bzip2 are decompressed natively, xz and lzma need the xz command to be installed:
+// if it is not found in the PATH, an error naming it is returned.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	header, err := br.Peek(len(xzMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("could not read header: %v", err)
+	}
+	switch DetectCompression(header) {
+	case Gzip:
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("could not read gzip data: %v", err)
+		}
+		return gr, nil
+	case Bzip2:
+		return ioutil.NopCloser(bzip2.NewReader(br)), nil
+	case Xz:
+		return newCmdReader(br, Xz, "xz", "--decompress", "--stdout", "--format=xz")
+	case Lzma:
+		return newCmdReader(br, Lzma, "xz", "--decompress", "--stdout", "--format=lzma")
+	default:
+		return ioutil.NopCloser(br), nil
+	}
+}
+
+// NewWriter returns a writer that compresses data in the given format before writing it to w.
+// The returned writer must be closed to flush the compressed data.
+// gzip is compressed natively, bzip2, xz and lzma need the bzip2 and xz commands to be installed:
+// if the needed command is not found in the PATH, an error naming it is returned.
+func NewWriter(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case NoCompression:
+		return nopWriteCloser{w}, nil
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Bzip2:
+		return newCmdWriter(w, Bzip2, "bzip2", "--compress", "--stdout")
+	case Xz:
+		return newCmdWriter(w, Xz, "xz", "--compress", "--stdout", "--format=xz")
+	case Lzma:
+		return newCmdWriter(w, Lzma, "xz", "--compress", "--stdout", "--format=lzma")
+	default:
+		return nil, fmt.Errorf("invalid compression %d", c)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// lookCommand returns the path of the external command name, which is needed to handle the compression format c.
+func lookCommand(c Compression, name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%s compression needs the %s command, which was not found in the PATH", c, name)
+	}
+	return path, nil
+}
+
+// cmdReader reads the output of an external decompression command.
+type cmdReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func newCmdReader(r io.Reader, c Compression, name string, args ...string) (io.ReadCloser, error) {
+	path, err := lookCommand(c, name)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = r
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not run %s: %v", name, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not run %s: %v", name, err)
+	}
+	return &cmdReader{ReadCloser: out, cmd: cmd}, nil
+}
+
+// Close stops the command and reports any error it met.
+func (r *cmdReader) Close() error {
+	r.ReadCloser.Close()
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s failed: %v", r.cmd.Path, err)
+	}
+	return nil
+}
+
+// cmdWriter writes data to an external compression command.
+type cmdWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func newCmdWriter(w io.Writer, c Compression, name string, args ...string) (io.WriteCloser, error) {
+	path, err := lookCommand(c, name)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = w
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not run %s: %v", name, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not run %s: %v", name, err)
+	}
+	return &cmdWriter{WriteCloser: in, cmd: cmd}, nil
+}
+
+// Close flushes the data to the command and waits for it to terminate.
+func (w *cmdWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s failed: %v", w.cmd.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package Preprocessor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestMissingCompressionCommand checks that formats handled by an external command are rejected
+// with an error naming the command when it is not installed.
+func TestMissingCompressionCommand(t *testing.T) {
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", "")
+	tests := []struct {
+		c   Compression
+		err string
+	}{
+		{c: Bzip2, err: "bzip2 compression needs the bzip2 command, which was not found in the PATH"},
+		{c: Xz, err: "xz compression needs the xz command, which was not found in the PATH"},
+		{c: Lzma, err: "lzma compression needs the xz command, which was not found in the PATH"},
+	}
+	for _, test := range tests {
+		if _, err := NewWriter(ioutil.Discard, test.c); err == nil {
+			t.Errorf("%v: expected error %q when writing, got none", test.c, test.err)
+		} else if err.Error() != test.err {
+			t.Errorf("%v: expected error %q when writing, got %q", test.c, test.err, err.Error())
+		}
+	}
+	const want = "xz compression needs the xz command, which was not found in the PATH"
+	if _, err := NewReader(bytes.NewReader(xzMagic)); err == nil || err.Error() != want {
+		t.Errorf("expected error %q when reading, got %v", want, err)
+	}
+	// gzip and bzip2 decompression need no command
+	for _, data := range [][]byte{gzipMagic, bzip2Magic} {
+		if _, err := NewReader(bytes.NewReader(data)); err != nil && strings.Contains(err.Error(), "command") {
+			t.Errorf("unexpected error %q", err.Error())
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package Preprocessor
+
+// COVERED CLAUSE ELIMINATION, INSPIRED BY http://fmv.jku.at/papers/HeuleJarvisaloBiere-LPAR10.pdf
+// A clause c is extended, while keeping the satisfiability of the problem, with two kinds of lits:
+//   - asymmetric lits (ALA): if a clause d contains x, and all its other lits are in c, -x can be added to c,
+//     since c is falsified only when -x is false, i.e x is true anyway. If all the lits of d are in c, c is implied.
+//   - covered lits (CLA): if all the non-tautological resolvents of c on one of its lits l contain
+//     a lit k, k can be added to c. In a model falsifying c but satisfying the extended clause, k is true,
+//     so l can be flipped without falsifying any clause containing -l.
+// If the extended clause becomes blocked, or a tautology, c can be removed. For each covered lit addition,
+// the clause as it was before the addition is pushed on the stack, with l as witness, and the blocked clause
+// is pushed last: when extending a model, the extended clause is satisfied first, and then each
+// previous version of c, until c itself is satisfied.
+// Since the extended clauses can be much longer than the original one, the nb of clauses that are visited
+// is bounded by Options.CoverEffort. Covered clauses are not eliminated from QBFs.
+
+// A coveredElim removes covered clauses from a problem, using its occurrence lists.
+type coveredElim struct {
+	pb     *Problem
+	o      *occLists
+	marks  []bool       // For each lit, true iff it is in the extended clause
+	ext    []Lit        // The extended clause
+	cover  []bool       // For each lit, true iff it is in all the non-tautological resolvents seen so far
+	seen   []bool       // For each lit, true iff it is in the clause being visited
+	stack  []StackEntry // Versions of the clause that must be pushed on the stack if it is removed
+	effort int          // Nb of clause visits that remain
+}
+
+// add adds lit to the extended clause.
+func (ce *coveredElim) add(lit Lit) {
+	ce.marks[lit] = true
+	ce.ext = append(ce.ext, lit)
+}
+
+// asymmetric adds asymmetric lits to the extended clause, until there is none left.
+// It returns true iff the clause is implied by another clause.
+func (ce *coveredElim) asymmetric(c *Clause) bool {
+	for i := 0; i < len(ce.ext) && ce.effort > 0; i++ {
+		for _, d := range ce.o.list(ce.ext[i]) {
+			if d == c || d.removed {
+				continue
+			}
+			ce.effort--
+			var unmarked Lit = -1
+			nbUnmarked := 0
+			for _, lit := range d.lits {
+				if !ce.marks[lit] {
+					unmarked = lit
+					nbUnmarked++
+					if nbUnmarked > 1 {
+						break
+					}
+				}
+			}
+			switch {
+			case nbUnmarked == 0:
+				return true
+			case nbUnmarked == 1 && !ce.marks[unmarked.Negation()]:
+				ce.add(unmarked.Negation())
+			}
+		}
+	}
+	return false
+}
+
+// covered adds the lits covering the extended clause on lit, and returns true iff the clause is blocked on lit.
+func (ce *coveredElim) covered(c *Clause, lit Lit) (blocked bool) {
+	var cover []Lit
+	first := true
+	for _, d := range ce.o.list(lit.Negation()) {
+		if d == c || d.removed {
+			continue
+		}
+		ce.effort--
+		taut := false
+		for _, lit2 := range d.lits {
+			if lit2 != lit.Negation() && ce.marks[lit2.Negation()] {
+				taut = true
+				break
+			}
+		}
+		if taut {
+			continue
+		}
+		if first {
+			first = false
+			for _, lit2 := range d.lits {
+				if lit2 != lit.Negation() && !ce.marks[lit2] {
+					ce.cover[lit2] = true
+					cover = append(cover, lit2)
+				}
+			}
+		} else {
+			for _, lit2 := range d.lits {
+				ce.seen[lit2] = true
+			}
+			n := 0
+			for _, lit2 := range cover {
+				if ce.seen[lit2] {
+					cover[n] = lit2
+					n++
+				} else {
+					ce.cover[lit2] = false
+				}
+			}
+			cover = cover[:n]
+			for _, lit2 := range d.lits {
+				ce.seen[lit2] = false
+			}
+		}
+		if len(cover) == 0 {
+			break
+		}
+	}
+	if first {
+		return true
+	}
+	if len(cover) != 0 {
+		ce.stack = append(ce.stack, StackEntry{Witness: lit, Clause: append([]Lit(nil), ce.ext...)})
+		for _, lit2 := range cover {
+			ce.cover[lit2] = false
+			ce.add(lit2)
+		}
+	}
+	return false
+}
+
+// eliminate extends c, and removes it if the extended clause is blocked or implied.
+// It returns true iff c was removed.
+func (ce *coveredElim) eliminate(c *Clause) bool {
+	pb := ce.pb
+	ce.ext = ce.ext[:0]
+	ce.stack = ce.stack[:0]
+	for _, lit := range c.lits {
+		ce.add(lit)
+	}
+	removed := false
+	var blocking Lit
+	for changed := true; changed && ce.effort > 0; {
+		if ce.asymmetric(c) {
+			removed, blocking = true, -1
+			break
+		}
+		n := len(ce.ext)
+		for i := 0; i < len(ce.ext) && ce.effort > 0; i++ {
+			if lit := ce.ext[i]; pb.blockable(lit.Var()) && ce.covered(c, lit) {
+				removed, blocking = true, lit
+				break
+			}
+		}
+		if removed {
+			break
+		}
+		changed = len(ce.ext) != n
+	}
+	for _, lit := range ce.ext {
+		ce.marks[lit] = false
+	}
+	if !removed {
+		return false
+	}
+	pb.stack = append(pb.stack, ce.stack...)
+	if blocking != -1 {
+		pb.push(blocking, &Clause{lits: ce.ext})
+	}
+	ce.o.remove(c)
+	return true
+}
+
+// eliminateCovered removes covered clauses, and returns the nb of removed clauses.
+func (pb *Problem) eliminateCovered() int {
+	effort := pb.options().CoverEffort
+	if pb.QBF() || effort <= 0 {
+		return 0
+	}
+	ce := &coveredElim{
+		pb:     pb,
+		o:      pb.newOccLists(),
+		marks:  make([]bool, 2*pb.NbVars),
+		cover:  make([]bool, 2*pb.NbVars),
+		seen:   make([]bool, 2*pb.NbVars),
+		effort: effort,
+	}
+	nb := 0
+	for _, c := range pb.Clauses {
+		if ce.effort <= 0 {
+			break
+		}
+		if ce.eliminate(c) {
+			nb++
+		}
+	}
+	pb.dropRemoved()
+	pb.Stats.Covered += nb
+	return nb
+}
@@ -0,0 +1,263 @@
+package Preprocessor
+
+import (
+	"container/heap"
+	"log"
+)
+
+// BOUNDED VARIABLE ELIMINATION, INSPIRED BY http://fmv.jku.at/papers/EenBiere-SAT05.pdf
+// A var v is eliminated by replacing the clauses containing v or -v by all their non-tautological resolvents on v.
+// This is only done when it doesn't make the problem grow too much: the nb of resolvents must not exceed
+// the nb of removed clauses plus Options.Grow, and no resolvent can be longer than Options.MaxResolventLen.
+// Vars are tried in increasing order of the product of the nb of occurrences of their lits, which is
+// an upper bound of the nb of resolvents, so cheap eliminations are done first.
+// Each time a var is eliminated, the cost of the vars of the modified clauses changes, so they are tried again.
+// Resolvents that are subsumed by an existing clause are not added, and new resolvents are used to
+// subsume or strengthen existing clauses.
+// When v is defined by a gate, resolvents of two non-gate clauses are not generated, see Gates.go.
+
+// elimHeap is a min-heap of candidate vars, keyed on the product of the nb of occurrences of their lits.
+type elimHeap struct {
+	vars  []Var
+	index []int // For each var, its index in vars, or -1 if it is not in the heap
+	costs []int // For each var in the heap, its cost
+}
+
+func (h *elimHeap) Len() int           { return len(h.vars) }
+func (h *elimHeap) Less(i, j int) bool { return h.costs[h.vars[i]] < h.costs[h.vars[j]] }
+
+func (h *elimHeap) Swap(i, j int) {
+	h.vars[i], h.vars[j] = h.vars[j], h.vars[i]
+	h.index[h.vars[i]] = i
+	h.index[h.vars[j]] = j
+}
+
+func (h *elimHeap) Push(x interface{}) {
+	v := x.(Var)
+	h.index[v] = len(h.vars)
+	h.vars = append(h.vars, v)
+}
+
+func (h *elimHeap) Pop() interface{} {
+	v := h.vars[len(h.vars)-1]
+	h.vars = h.vars[:len(h.vars)-1]
+	h.index[v] = -1
+	return v
+}
+
+// An eliminator eliminates vars from a problem, using its occurrence lists.
+type eliminator struct {
+	pb     *Problem
+	o      *occLists
+	heap   elimHeap
+	marks  []bool // For each lit, true iff it is in the clause being resolved
+	grow   int
+	maxLen int
+}
+
+// newEliminator returns an eliminator for pb, where all vars that can be eliminated are candidates.
+func (pb *Problem) newEliminator() *eliminator {
+	opts := pb.options()
+	e := &eliminator{
+		pb:     pb,
+		o:      pb.newOccLists(),
+		heap:   elimHeap{index: make([]int, pb.NbVars), costs: make([]int, pb.NbVars)},
+		marks:  make([]bool, 2*pb.NbVars),
+		grow:   opts.Grow,
+		maxLen: opts.MaxResolventLen,
+	}
+	for v := range e.heap.index {
+		e.heap.index[v] = -1
+	}
+	for v := 0; v < pb.NbVars; v++ {
+		e.update(Var(v))
+	}
+	return e
+}
+
+// candidate returns true iff v can be eliminated.
+func (e *eliminator) candidate(v Var) bool {
+	return e.pb.Model[v] == 0 && !e.pb.isFrozen(v) && e.pb.innermostExistential(v)
+}
+
+// update updates the cost of v, and adds it to the heap if it is a candidate that is not in the heap yet.
+func (e *eliminator) update(v Var) {
+	if !e.candidate(v) {
+		return
+	}
+	nbPos := len(e.o.list(v.Lit()))
+	nbNeg := len(e.o.list(v.Lit().Negation()))
+	if nbPos == 0 && nbNeg == 0 {
+		return
+	}
+	e.heap.costs[v] = nbPos * nbNeg
+	if e.heap.index[v] == -1 {
+		heap.Push(&e.heap, v)
+	} else {
+		heap.Fix(&e.heap, e.heap.index[v])
+	}
+}
+
+// resolventLen returns the length of the resolvent of c1 and c2 on v, and whether it is a tautology.
+// The lits of c1 must be marked.
+func (e *eliminator) resolventLen(c2 *Clause, v Var, len1 int) (length int, taut bool) {
+	length = len1
+	for _, lit := range c2.lits {
+		if lit.Var() == v {
+			continue
+		}
+		if e.marks[lit.Negation()] {
+			return 0, true
+		}
+		if !e.marks[lit] {
+			length++
+		}
+	}
+	return length, false
+}
+
+// mark marks or unmarks the lits of c, except the lits of v, and returns the nb of lits that are marked.
+func (e *eliminator) mark(c *Clause, v Var, marked bool) int {
+	n := 0
+	for _, lit := range c.lits {
+		if lit.Var() != v {
+			e.marks[lit] = marked
+			n++
+		}
+	}
+	return n
+}
+
+// bounded returns true iff eliminating v by resolving the clauses of pos against the clauses of neg
+// doesn't produce more than len(pos)+len(neg)+grow non-tautological resolvents, or a resolvent
+// longer than maxLen. If gated is true, non-gate clauses are not resolved with each other.
+func (e *eliminator) bounded(v Var, pos, neg []*Clause, gated bool) bool {
+	limit := len(pos) + len(neg) + e.grow
+	nb := 0
+	for _, c1 := range pos {
+		len1 := e.mark(c1, v, true)
+		for _, c2 := range neg {
+			if gated && !c1.gate && !c2.gate {
+				continue
+			}
+			length, taut := e.resolventLen(c2, v, len1)
+			if taut {
+				continue
+			}
+			nb++
+			if nb > limit || (e.maxLen > 0 && length > e.maxLen) {
+				e.mark(c1, v, false)
+				return false
+			}
+		}
+		e.mark(c1, v, false)
+	}
+	return true
+}
+
+// subsumed returns true iff c is subsumed by a clause of the problem.
+// The lits of c must be sorted and its signature must be up to date.
+func (e *eliminator) subsumed(c *Clause) bool {
+	for _, lit := range c.lits {
+		for _, d := range e.o.list(lit) {
+			if !d.removed && d.Len() <= c.Len() && d.sig&^c.sig == 0 && d.Subsumes(c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// eliminate eliminates v if the elimination is bounded, and returns true iff v was eliminated.
+func (e *eliminator) eliminate(v Var) bool {
+	pb := e.pb
+	lit := v.Lit()
+	pos := e.o.list(lit)
+	neg := e.o.list(lit.Negation())
+	if len(pos)+len(neg) == 0 {
+		return false
+	}
+	kind := e.findGate(v, pos, neg)
+	gated := kind != noGate
+	if !e.bounded(v, pos, neg, gated) {
+		clearGate(pos, neg)
+		return false
+	}
+	log.Printf("%d can be removed: %d and %d", lit.Int(), len(pos), len(neg))
+	if gated {
+		logGate(v, kind, pos, neg)
+	}
+	pb.Stats.EliminatedVars++
+	pb.Stats.Gates.count(kind)
+	var touched []Var
+	for _, c1 := range pos {
+		for _, c2 := range neg {
+			if gated && !c1.gate && !c2.gate {
+				continue
+			}
+			r := c1.Generate(c2, v)
+			if r.Simplify() {
+				continue
+			}
+			pb.reduceUniversals(r)
+			r.sig = signature(r.lits)
+			if e.subsumed(r) {
+				continue
+			}
+			r.id = pb.proofAdd(r.lits, c1.id, c2.id)
+			switch r.Len() {
+			case 0:
+				pb.Status = Unsat
+				return true
+			case 1:
+				e.o.unit(r)
+				if pb.Status == Unsat {
+					return true
+				}
+			default:
+				pb.Clauses = append(pb.Clauses, r)
+				e.o.add(r)
+				e.o.push(r)
+			}
+			for _, lit2 := range r.lits {
+				touched = append(touched, lit2.Var())
+			}
+		}
+	}
+	clearGate(pos, neg)
+	// the clauses containing v are removed, and pushed on the stack so that v can be given a value when extending a model
+	for _, c := range pos {
+		pb.push(lit, c)
+		e.o.remove(c)
+		for _, lit2 := range c.lits {
+			touched = append(touched, lit2.Var())
+		}
+	}
+	for _, c := range neg {
+		pb.push(lit.Negation(), c)
+		e.o.remove(c)
+		for _, lit2 := range c.lits {
+			touched = append(touched, lit2.Var())
+		}
+	}
+	e.o.subsume()
+	for _, v2 := range touched {
+		e.update(v2)
+	}
+	return true
+}
+
+// eliminateVars eliminates vars until no more var can be eliminated, or the problem is UNSAT,
+// and returns the nb of eliminated vars.
+func (pb *Problem) eliminateVars() int {
+	e := pb.newEliminator()
+	nb := 0
+	for e.heap.Len() != 0 && pb.Status != Unsat {
+		v := heap.Pop(&e.heap).(Var)
+		if e.candidate(v) && e.eliminate(v) {
+			nb++
+		}
+	}
+	pb.dropRemoved()
+	return nb
+}
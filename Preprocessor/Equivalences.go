@@ -0,0 +1,287 @@
+package Preprocessor
+
+import "log"
+
+// EQUIVALENT LITERAL SUBSTITUTION, USING THE STRONGLY CONNECTED COMPONENTS OF THE BINARY IMPLICATION GRAPH
+// Each binary clause (a b) is seen as two implications, -a => b and -b => a. All the lits of a strongly
+// connected component (SCC) of that graph are equivalent, so they can all be replaced by a representative.
+// If a lit and its negation are in the same SCC, the problem is UNSAT.
+// The SCC of the negations of the lits of an SCC is an SCC too, and its representative is the negation of the
+// first one's. Frozen vars must survive, so the representative is a frozen lit if there is one, and frozen lits
+// are never substituted. Each substituted var x, whose representative is r, is pushed on the stack as
+// the clauses (x -r) and (-x r), so that x gets the value of r when extending a model.
+// When writing a proof, the equivalences (-x r) are first derived for each substituted lit x, following the path
+// from x to r in the SCC, and then used as hints to rewrite the clauses.
+// Units and the cost function never need to be rewritten: units bind vars that don't appear in clauses anymore,
+// so they are never in an SCC, and the vars of the cost function are frozen by SetCostFunc, so they are never
+// substituted, although they can be the representative of other lits.
+// Equivalences are not substituted in QBFs.
+
+// An equivalences finds the SCCs of the binary implication graph of a problem, with Tarjan's algorithm.
+type equivalences struct {
+	pb       *Problem
+	edges    [][]Lit // For each lit a, the lits b such that a => b
+	ids      [][]int // For each lit a, the IDs of the clauses giving the implications of edges[a]
+	index    []int   // For each lit, its index in the DFS, or -1 if it was not visited yet
+	low      []int   // For each lit, the smallest index reachable from it
+	onStack  []bool  // For each lit, true iff it is on the stack of the DFS
+	stack    []Lit   // Lits whose SCC was not found yet
+	sccs     [][]Lit // The SCCs of more than one lit, in reverse topological order
+	comp     []int   // For each lit, 1 + the index of its SCC in sccs, or 0
+	next     int     // Index of the next visited lit
+	repr     []Lit   // For each lit, its representative
+	eqIDs    []int   // For each substituted lit x, the ID of the clause (-x repr(x)), when writing a proof
+	unsat    bool    // True iff a lit and its negation are in the same SCC
+	conflict Lit     // If unsat, a lit whose negation is in its SCC
+}
+
+// newEquivalences builds the binary implication graph of pb.
+func (pb *Problem) newEquivalences() *equivalences {
+	nbLits := 2 * pb.NbVars
+	eq := &equivalences{
+		pb:      pb,
+		edges:   make([][]Lit, nbLits),
+		ids:     make([][]int, nbLits),
+		index:   make([]int, nbLits),
+		low:     make([]int, nbLits),
+		onStack: make([]bool, nbLits),
+		repr:    make([]Lit, nbLits),
+	}
+	for lit := range eq.index {
+		eq.index[lit] = -1
+		eq.repr[lit] = Lit(lit)
+	}
+	for _, c := range pb.Clauses {
+		if c.Len() != 2 {
+			continue
+		}
+		a, b := c.lits[0], c.lits[1]
+		eq.edges[a.Negation()] = append(eq.edges[a.Negation()], b)
+		eq.ids[a.Negation()] = append(eq.ids[a.Negation()], c.id)
+		eq.edges[b.Negation()] = append(eq.edges[b.Negation()], a)
+		eq.ids[b.Negation()] = append(eq.ids[b.Negation()], c.id)
+	}
+	return eq
+}
+
+// visit is the recursive part of Tarjan's algorithm.
+func (eq *equivalences) visit(lit Lit) {
+	eq.index[lit] = eq.next
+	eq.low[lit] = eq.next
+	eq.next++
+	eq.stack = append(eq.stack, lit)
+	eq.onStack[lit] = true
+	for _, lit2 := range eq.edges[lit] {
+		if eq.index[lit2] == -1 {
+			eq.visit(lit2)
+			if eq.low[lit2] < eq.low[lit] {
+				eq.low[lit] = eq.low[lit2]
+			}
+		} else if eq.onStack[lit2] && eq.index[lit2] < eq.low[lit] {
+			eq.low[lit] = eq.index[lit2]
+		}
+	}
+	if eq.low[lit] != eq.index[lit] {
+		return
+	}
+	i := len(eq.stack) - 1
+	for eq.stack[i] != lit {
+		i--
+	}
+	scc := append([]Lit(nil), eq.stack[i:]...)
+	eq.stack = eq.stack[:i]
+	for _, lit2 := range scc {
+		eq.onStack[lit2] = false
+	}
+	if len(scc) > 1 {
+		eq.sccs = append(eq.sccs, scc)
+	}
+}
+
+// findSCCs finds all the SCCs, and chooses their representatives.
+func (eq *equivalences) findSCCs() {
+	pb := eq.pb
+	for lit := range eq.index {
+		if eq.index[lit] == -1 && len(eq.edges[lit]) != 0 {
+			eq.visit(Lit(lit))
+		}
+	}
+	eq.comp = make([]int, 2*pb.NbVars)
+	for i, scc := range eq.sccs {
+		for _, lit := range scc {
+			eq.comp[lit] = i + 1
+		}
+	}
+	for i, scc := range eq.sccs {
+		if eq.comp[scc[0].Negation()] == i+1 {
+			for _, lit := range scc {
+				if eq.comp[lit.Negation()] == i+1 {
+					eq.unsat, eq.conflict = true, lit
+					return
+				}
+			}
+		}
+		// The choice only depends on vars, so the dual SCC gets the negation of the same representative
+		rep := scc[0]
+		for _, lit := range scc {
+			if pb.isFrozen(lit.Var()) && !pb.isFrozen(rep.Var()) || pb.isFrozen(lit.Var()) == pb.isFrozen(rep.Var()) && lit.Var() < rep.Var() {
+				rep = lit
+			}
+		}
+		for _, lit := range scc {
+			if lit != rep && !pb.isFrozen(lit.Var()) {
+				eq.repr[lit] = rep
+				eq.repr[lit.Negation()] = rep.Negation()
+			}
+		}
+	}
+}
+
+// path returns the IDs of the clauses implying each lit of a path from a to b, using BFS.
+// a and b must be in the same SCC, so only the lits of that SCC are visited.
+func (eq *equivalences) path(a, b Lit) []int {
+	parent := map[Lit]Lit{a: a}
+	parentID := map[Lit]int{}
+	queue := []Lit{a}
+	for len(queue) != 0 && parent[b] == 0 && b != a {
+		lit := queue[0]
+		queue = queue[1:]
+		for i, lit2 := range eq.edges[lit] {
+			if _, ok := parent[lit2]; !ok && eq.comp[lit2] == eq.comp[a] {
+				parent[lit2] = lit
+				parentID[lit2] = eq.ids[lit][i]
+				queue = append(queue, lit2)
+			}
+		}
+	}
+	var ids []int
+	for lit := b; lit != a; lit = parent[lit] {
+		ids = append(ids, parentID[lit])
+	}
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	return ids
+}
+
+// deriveUnsat writes the derivation of the empty clause in the proof: the unit -lit is derived from the path
+// from lit to -lit, and then the empty clause from the path from -lit to lit.
+func (eq *equivalences) deriveUnsat() {
+	pb := eq.pb
+	lit := eq.conflict
+	id := pb.proofAdd([]Lit{lit.Negation()}, eq.path(lit, lit.Negation())...)
+	pb.proofAdd(nil, append([]int{id}, eq.path(lit.Negation(), lit)...)...)
+}
+
+// deriveEquivalences writes the clauses (-x repr(x)) in the proof, for each substituted lit x.
+func (eq *equivalences) deriveEquivalences() {
+	pb := eq.pb
+	if pb.proof == nil {
+		return
+	}
+	eq.eqIDs = make([]int, 2*pb.NbVars)
+	for lit, rep := range eq.repr {
+		if rep != Lit(lit) {
+			eq.eqIDs[lit] = pb.proofAdd([]Lit{Lit(lit).Negation(), rep}, eq.path(Lit(lit), rep)...)
+		}
+	}
+}
+
+// deleteEquivalences deletes the clauses (-x repr(x)) from the proof, once they are not needed anymore.
+func (eq *equivalences) deleteEquivalences() {
+	for lit, id := range eq.eqIDs {
+		if id != 0 {
+			eq.pb.proofDelete(id, []Lit{Lit(lit).Negation(), eq.repr[lit]})
+		}
+	}
+}
+
+// substitute replaces the lits of c by their representatives. It returns true iff c became a tautology.
+func (eq *equivalences) substitute(c *Clause) (isSat bool) {
+	pb := eq.pb
+	var old []Lit // For the proof, lits of the clause before it was rewritten
+	var hints []int
+	changed := false
+	for i, lit := range c.lits {
+		if rep := eq.repr[lit]; rep != lit {
+			if pb.proof != nil {
+				if old == nil {
+					old = append([]Lit(nil), c.lits...)
+				}
+				hints = append(hints, eq.eqIDs[lit])
+			}
+			c.lits[i] = rep
+			changed = true
+		}
+	}
+	if !changed {
+		return false
+	}
+	if c.Simplify() {
+		pb.proofDelete(c.id, old)
+		return true
+	}
+	id := pb.proofAdd(c.lits, append(hints, c.id)...)
+	pb.proofDelete(c.id, old)
+	c.id = id
+	return false
+}
+
+// substituteEquivalences replaces equivalent lits by their representative in the whole problem,
+// and returns the nb of substituted vars.
+func (pb *Problem) substituteEquivalences() int {
+	if pb.QBF() {
+		return 0
+	}
+	eq := pb.newEquivalences()
+	eq.findSCCs()
+	if eq.unsat {
+		log.Printf("%d and its negation are equivalent", eq.conflict.Int())
+		eq.deriveUnsat()
+		pb.Status = Unsat
+		return 0
+	}
+	nb := 0
+	for v := 0; v < pb.NbVars; v++ {
+		if lit := Var(v).Lit(); eq.repr[lit] != lit {
+			pb.push(lit, NewClause([]Lit{lit, eq.repr[lit].Negation()}))
+			pb.push(lit.Negation(), NewClause([]Lit{lit.Negation(), eq.repr[lit]}))
+			nb++
+		}
+	}
+	if nb == 0 {
+		return 0
+	}
+	eq.deriveEquivalences()
+	nbKept := 0
+	nbUnits := len(pb.Units)
+	for _, c := range pb.Clauses {
+		if eq.substitute(c) {
+			continue
+		}
+		if c.Len() == 1 {
+			lit := c.First()
+			switch {
+			case pb.Model[lit.Var()] == 0:
+				pb.setUnitID(lit, c.id)
+				pb.addUnit(lit)
+			case (pb.Model[lit.Var()] == 1) == lit.IsPositive():
+				pb.proofDelete(c.id, c.lits)
+			default:
+				pb.proofAdd(nil, c.id, pb.unitID(lit.Var()))
+				pb.Status = Unsat
+				return nb
+			}
+			continue
+		}
+		pb.Clauses[nbKept] = c
+		nbKept++
+	}
+	pb.Clauses = pb.Clauses[:nbKept]
+	eq.deleteEquivalences()
+	pb.Stats.Substituted += nb
+	if len(pb.Units) != nbUnits {
+		pb.Simplify2()
+	}
+	return nb
+}
@@ -0,0 +1,325 @@
+package Preprocessor
+
+import "log"
+
+// GATE DETECTION FOR VARIABLE ELIMINATION, INSPIRED BY http://fmv.jku.at/papers/EenBiere-SAT05.pdf
+// When a var v is defined by some of its clauses, e.g v <=> (a AND b) is defined by (-v a), (-v b) and (v -a -b),
+// the clauses of v are split into gate clauses, that define v, and the other ones. Resolvents of two non-gate
+// clauses are not needed: whatever the values of the other vars, some gate clause forces the value of v,
+// so the other clauses are satisfied as long as their resolvents with that gate clause are.
+// For gates that are detected syntactically, resolvents of two gate clauses are tautologies, so only the
+// resolvents of a gate clause with a non-gate clause are added.
+// AND (and OR) gates, ITE gates and XOR gates are detected syntactically. Other definitions are detected
+// semantically: the clauses of v, once v is removed, are unsatisfiable iff they define v, and the clauses
+// of an unsatisfiable core are then the gate clauses. Since this requires a small SAT solver, it is only done
+// for vars with few occurrences.
+
+// A gateKind is the kind of definition found for a var.
+type gateKind byte
+
+const (
+	noGate = gateKind(iota)
+	andGate
+	iteGate
+	xorGate
+	semanticGate
+)
+
+const (
+	maxXorArity     = 4    // Max nb of inputs of a detected XOR gate
+	maxSemanticOccs = 16   // Max nb of clauses of a var for semantic detection
+	maxSemanticWork = 2000 // Max nb of decisions of a search for semantic detection
+)
+
+// Gates are the nb of gates of each kind that were used to eliminate vars.
+type Gates struct {
+	And      int `json:"and"` // Including OR gates, i.e AND gates with negated inputs or output
+	ITE      int `json:"ite"`
+	Xor      int `json:"xor"`
+	Semantic int `json:"semantic"`
+}
+
+// count counts a gate of the given kind.
+func (g *Gates) count(kind gateKind) {
+	switch kind {
+	case andGate:
+		g.And++
+	case iteGate:
+		g.ITE++
+	case xorGate:
+		g.Xor++
+	case semanticGate:
+		g.Semantic++
+	}
+}
+
+// findGate looks for a definition of v among the clauses of pos (containing v) and neg (containing -v).
+// If one is found, the gate clauses are marked as such, and the kind of gate is returned.
+func (e *eliminator) findGate(v Var, pos, neg []*Clause) gateKind {
+	if len(pos) == 0 || len(neg) == 0 {
+		return noGate
+	}
+	switch {
+	case e.findAnd(v.Lit(), pos, neg) || e.findAnd(v.Lit().Negation(), neg, pos):
+		return andGate
+	case e.findITE(v.Lit(), pos, neg):
+		return iteGate
+	case e.findXor(pos, neg):
+		return xorGate
+	case e.findSemantic(v, pos, neg):
+		return semanticGate
+	}
+	return noGate
+}
+
+// clearGate unmarks the gate clauses.
+func clearGate(pos, neg []*Clause) {
+	for _, c := range pos {
+		c.gate = false
+	}
+	for _, c := range neg {
+		c.gate = false
+	}
+}
+
+// findAnd looks for a definition x <=> (l1 AND ... AND ln), i.e for binary clauses (-x li) in negs,
+// and a clause (x -l1 ... -ln) in poss.
+func (e *eliminator) findAnd(x Lit, poss, negs []*Clause) bool {
+	for _, c := range negs {
+		if c.Len() == 2 {
+			e.marks[c.other(x.Negation())] = true
+		}
+	}
+	var def *Clause
+	for _, c := range poss {
+		found := true
+		for _, lit := range c.lits {
+			if lit != x && !e.marks[lit.Negation()] {
+				found = false
+				break
+			}
+		}
+		if found {
+			def = c
+			break
+		}
+	}
+	for _, c := range negs {
+		if c.Len() == 2 {
+			lit := c.other(x.Negation())
+			if def != nil && e.marks[lit] && def.contains(lit.Negation()) { // Duplicates are unmarked, so they are not part of the gate
+				c.gate = true
+			}
+			e.marks[lit] = false
+		}
+	}
+	if def == nil {
+		return false
+	}
+	def.gate = true
+	return true
+}
+
+// other returns the lit of the binary clause c that is not lit.
+func (c *Clause) other(lit Lit) Lit {
+	if c.lits[0] == lit {
+		return c.lits[1]
+	}
+	return c.lits[0]
+}
+
+// findTernary returns the ternary clause of cs containing a and b, or nil.
+func findTernary(cs []*Clause, a, b Lit) *Clause {
+	for _, c := range cs {
+		if c.Len() == 3 && c.contains(a) && c.contains(b) {
+			return c
+		}
+	}
+	return nil
+}
+
+// findITE looks for a definition x <=> (c ? t : e), i.e for the clauses (-x -c t) and (-x c e) in negs,
+// and (x -c -t) and (x c -e) in poss.
+func (e *eliminator) findITE(x Lit, poss, negs []*Clause) bool {
+	for _, c1 := range negs {
+		if c1.Len() != 3 {
+			continue
+		}
+		for _, cond := range c1.lits {
+			if cond == x.Negation() {
+				continue
+			}
+			cond = cond.Negation()
+			t := c1.other3(x.Negation(), cond.Negation())
+			for _, c2 := range negs {
+				if c2 == c1 || c2.Len() != 3 || !c2.contains(cond) {
+					continue
+				}
+				el := c2.other3(x.Negation(), cond)
+				if el.Var() == t.Var() {
+					continue
+				}
+				c3 := findTernary(poss, cond.Negation(), t.Negation())
+				c4 := findTernary(poss, cond, el.Negation())
+				if c3 != nil && c4 != nil {
+					c1.gate, c2.gate, c3.gate, c4.gate = true, true, true, true
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// other3 returns the lit of the ternary clause c that is neither a nor b.
+func (c *Clause) other3(a, b Lit) Lit {
+	for _, lit := range c.lits {
+		if lit != a && lit != b {
+			return lit
+		}
+	}
+	panic("clause is not ternary")
+}
+
+// findXor looks for a definition v <=> (l1 XOR ... XOR ln), i.e for all the 2^n clauses over the vars
+// of v, l1, ... ln whose nb of negative lits has a given parity.
+// Clauses are sorted, so two clauses over the same vars have their lits in the same order,
+// and the clauses over the same vars as c can be identified by the signs of their lits.
+func (e *eliminator) findXor(pos, neg []*Clause) bool {
+	for _, c := range pos {
+		if c.Len() < 3 || c.Len() > maxXorArity+1 {
+			continue
+		}
+		parity := c.parity()
+		need := 1 << uint(c.Len()-1)
+		found := make(map[uint]*Clause, need)
+		for _, cs := range [][]*Clause{pos, neg} {
+			for _, d := range cs {
+				if d.Len() != c.Len() || d.sig != c.sig || d.parity() != parity {
+					continue
+				}
+				var signs uint
+				same := true
+				for i, lit := range d.lits {
+					if lit.Var() != c.lits[i].Var() {
+						same = false
+						break
+					}
+					if !lit.IsPositive() {
+						signs |= 1 << uint(i)
+					}
+				}
+				if same && found[signs] == nil {
+					found[signs] = d
+				}
+			}
+		}
+		if len(found) == need {
+			for _, d := range found {
+				d.gate = true
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// parity returns the parity of the nb of negative lits of c.
+func (c *Clause) parity() int {
+	p := 0
+	for _, lit := range c.lits {
+		if !lit.IsPositive() {
+			p ^= 1
+		}
+	}
+	return p
+}
+
+// findSemantic checks whether the clauses of v, once v is removed, are unsatisfiable,
+// and if so marks the clauses of a minimal unsatisfiable subset as gate clauses.
+func (e *eliminator) findSemantic(v Var, pos, neg []*Clause) bool {
+	if len(pos)+len(neg) > maxSemanticOccs {
+		return false
+	}
+	var clauses []*Clause
+	clauses = append(append(clauses, pos...), neg...)
+	if !e.unsat(v, clauses) {
+		return false
+	}
+	// deletion-based minimization: a clause is dropped if the other ones are still unsatisfiable
+	core := clauses
+	for i := 0; i < len(core); {
+		rest := append(append([]*Clause(nil), core[:i]...), core[i+1:]...)
+		if e.unsat(v, rest) {
+			core = rest
+		} else {
+			i++
+		}
+	}
+	for _, c := range core {
+		c.gate = true
+	}
+	return true
+}
+
+// unsat returns true iff the clauses, once the lits of v are removed, are unsatisfiable.
+// If the search takes too long, false is returned.
+func (e *eliminator) unsat(v Var, clauses []*Clause) bool {
+	work := 0
+	return e.search(v, clauses, &work) == 0
+}
+
+// search is a DPLL search of a model of the clauses without the lits of v, where true lits are marked.
+// It returns 1 if a model was found, 0 if there is none, and -1 if the search was interrupted.
+func (e *eliminator) search(v Var, clauses []*Clause, work *int) int {
+	for _, c := range clauses {
+		var free Lit = -1
+		sat := false
+		for _, lit := range c.lits {
+			if lit.Var() == v || e.marks[lit.Negation()] {
+				continue
+			}
+			if e.marks[lit] {
+				sat = true
+				break
+			}
+			if free == -1 {
+				free = lit
+			}
+		}
+		if sat {
+			continue
+		}
+		if free == -1 {
+			return 0
+		}
+		*work++
+		if *work > maxSemanticWork {
+			return -1
+		}
+		for _, lit := range []Lit{free, free.Negation()} {
+			e.marks[lit] = true
+			res := e.search(v, clauses, work)
+			e.marks[lit] = false
+			if res != 0 {
+				return res
+			}
+		}
+		return 0
+	}
+	return 1
+}
+
+// logGate logs the definition found for v.
+func logGate(v Var, kind gateKind, pos, neg []*Clause) {
+	nb := 0
+	for _, cs := range [][]*Clause{pos, neg} {
+		for _, c := range cs {
+			if c.gate {
+				nb++
+			}
+		}
+	}
+	names := [...]string{"no", "AND", "ITE", "XOR", "semantic"}
+	log.Printf("%d is defined by a %s gate of %d clauses", v.Lit().Int(), names[kind], nb)
+}
@@ -0,0 +1,209 @@
+package Preprocessor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// INCREMENTAL PROBLEMS, AS DESCRIBED BY ICNF FILES
+
+// An Incremental problem is a sequence of clause batches, each one followed by a cube of assumptions.
+// The ith cube must be solved under the clauses of batches 0 to i.
+type Incremental struct {
+	NbVars  int
+	Batches [][]*Clause // Batches[i] is added before solving under Cubes[i]. The last batch is not followed by any cube.
+	Cubes   [][]Lit
+	Options *Options // Settings used to preprocess each batch. If nil, DefaultOptions are used.
+	Status  Status   // After preprocessing, Unsat iff the clauses are UNSAT even without assumptions, else Undetermined
+}
+
+// ParseICNF parses an iCNF file, i.e a "p inccnf" header followed by clauses interleaved with
+// "a lits 0" assumption lines, and returns the corresponding incremental problem.
+// Since the header doesn't give the nb of vars, NbVars grows to accomodate every var.
+func ParseICNF(f io.Reader) (*Incremental, error) {
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024*1024)
+	var (
+		inc    = &Incremental{Batches: [][]*Clause{nil}}
+		header = false
+		lits   []Lit // Lits of the current clause, which can span several lines
+		lineNb = 0
+	)
+	for sc.Scan() {
+		lineNb++
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || fields[0][0] == 'c' {
+			continue
+		}
+		if fields[0] == "p" {
+			if header {
+				return nil, fmt.Errorf("line %d: duplicate header", lineNb)
+			}
+			if len(fields) != 2 || fields[1] != "inccnf" {
+				return nil, fmt.Errorf("line %d: invalid syntax %q in header", lineNb, strings.Join(fields, " "))
+			}
+			header = true
+			continue
+		}
+		if !header {
+			return nil, fmt.Errorf("line %d: clause found before header", lineNb)
+		}
+		if fields[0] == "a" {
+			if len(lits) != 0 {
+				return nil, fmt.Errorf("line %d: assumptions found inside a clause", lineNb)
+			}
+			if len(fields) < 2 || fields[len(fields)-1] != "0" {
+				return nil, fmt.Errorf("line %d: assumptions do not end with 0", lineNb)
+			}
+			cube := make([]Lit, 0, len(fields)-2)
+			for _, field := range fields[1 : len(fields)-1] {
+				lit, end, err := inc.parseLit(field)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", lineNb, err)
+				}
+				if end {
+					return nil, fmt.Errorf("line %d: unexpected 0 inside assumptions", lineNb)
+				}
+				cube = append(cube, lit)
+			}
+			inc.Cubes = append(inc.Cubes, cube)
+			inc.Batches = append(inc.Batches, nil)
+			continue
+		}
+		for _, field := range fields {
+			lit, end, err := inc.parseLit(field)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNb, err)
+			}
+			if !end {
+				lits = append(lits, lit)
+				continue
+			}
+			last := len(inc.Batches) - 1
+			inc.Batches[last] = append(inc.Batches[last], NewClause(lits))
+			lits = nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("could not read iCNF: %v", err)
+	}
+	if !header {
+		return nil, fmt.Errorf("no header found")
+	}
+	if len(lits) != 0 {
+		return nil, fmt.Errorf("line %d: unfinished clause while EOF found", lineNb)
+	}
+	return inc, nil
+}
+
+// parseLit parses a DIMACS lit, growing NbVars if needed. end is true iff the lit was 0.
+func (inc *Incremental) parseLit(field string) (lit Lit, end bool, err error) {
+	val, err := strconv.ParseInt(field, 10, 32)
+	if err != nil || val == -1<<31 {
+		return 0, false, fmt.Errorf("invalid literal %q", field)
+	}
+	if val == 0 {
+		return 0, true, nil
+	}
+	v := int(val)
+	if v < 0 {
+		v = -v
+	}
+	if v > inc.NbVars {
+		inc.NbVars = v
+	}
+	return IntToLit(int32(val)), false, nil
+}
+
+// ICNF returns an iCNF representation of the incremental problem, as written by WriteICNF.
+func (inc *Incremental) ICNF() string {
+	return toString(inc.WriteICNF)
+}
+
+// Preprocess simplifies the incremental problem, so that each cube keeps the same answer.
+// Batches are preprocessed one after the other: vars that appear in any cube, or in a later batch,
+// are frozen, so that eliminating a var never conflicts with clauses or assumptions that come after.
+// Since clauses can't be removed from an iCNF file, each batch is replaced by the clauses and
+// units that were derived since the previous cube. Clauses that were removed by the preprocessor
+// are still present in the output, but they only contain eliminated vars or are implied by the units,
+// so they don't change the answer.
+func (inc *Incremental) Preprocess() {
+	assumed := make([]bool, inc.NbVars)  // true iff the var appears in a cube
+	lastBatch := make([]int, inc.NbVars) // index of the last batch where the var appears
+	for i, batch := range inc.Batches {
+		for _, c := range batch {
+			for _, lit := range c.lits {
+				lastBatch[lit.Var()] = i
+			}
+		}
+	}
+	for _, cube := range inc.Cubes {
+		for _, lit := range cube {
+			assumed[lit.Var()] = true
+		}
+	}
+	pb := &Problem{NbVars: inc.NbVars, Model: make([]decLevel, inc.NbVars), Options: inc.Options}
+	emitted := make(map[string]bool)
+	nbUnits := 0
+	for i, batch := range inc.Batches {
+		var res []*Clause
+		if pb.Status != Unsat {
+			for _, c := range batch {
+				if c.Len() == 0 {
+					pb.Status = Unsat
+					break
+				}
+				pb.Clauses = append(pb.Clauses, NewClause(append([]Lit(nil), c.lits...)))
+			}
+		}
+		if pb.Status != Unsat {
+			pb.Status = Undetermined // A SAT problem can be made UNSAT by new clauses
+			pb.frozen = make([]bool, pb.NbVars)
+			for v := range pb.frozen {
+				pb.frozen[v] = assumed[v] || lastBatch[v] > i
+			}
+			pb.Simplify2()
+			if pb.Status != Unsat {
+				pb.Preprocess()
+			}
+		}
+		if pb.Status == Unsat {
+			if !emitted[""] {
+				emitted[""] = true
+				res = append(res, NewClause(nil))
+			}
+		} else {
+			for _, unit := range pb.Units[nbUnits:] {
+				res = append(res, NewClause([]Lit{unit}))
+			}
+			nbUnits = len(pb.Units)
+			for _, c := range pb.Clauses {
+				if key := clauseKey(c); !emitted[key] {
+					emitted[key] = true
+					res = append(res, NewClause(append([]Lit(nil), c.lits...)))
+				}
+			}
+		}
+		inc.Batches[i] = res
+	}
+	inc.Status = Undetermined
+	if pb.Status == Unsat {
+		inc.Status = Unsat
+	}
+}
+
+// clauseKey returns a string identifying the set of lits of c, whatever their order.
+func clauseKey(c *Clause) string {
+	lits := append([]Lit(nil), c.lits...)
+	sort.Slice(lits, func(i, j int) bool { return lits[i] < lits[j] })
+	buf := make([]byte, 0, 4*len(lits))
+	for _, lit := range lits {
+		buf = strconv.AppendInt(buf, int64(lit.Int()), 10)
+		buf = append(buf, ' ')
+	}
+	return string(buf)
+}
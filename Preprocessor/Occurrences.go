@@ -0,0 +1,254 @@
+package Preprocessor
+
+import "log"
+
+// OCCURRENCE LISTS, BACKWARD SUBSUMPTION AND SELF-SUBSUMING RESOLUTION, INSPIRED BY http://fmv.jku.at/papers/EenBiere-SAT05.pdf
+// Each clause has a 64-bit signature, where bit i is set iff the clause contains a var v with v%64 == i.
+// If c subsumes d, then the signature of c is included in the signature of d, so most pairs of clauses
+// can be discarded without comparing their lits. Since signatures are computed on vars, the same filter
+// works when c only subsumes d after one of its lits is negated, i.e for self-subsuming resolution.
+// Clauses are never removed from the lists directly: they are marked as removed, and the lists are cleaned
+// lazily, when they are traversed. Removed clauses are dropped from pb.Clauses once the lists are not needed anymore.
+// The same goes for lits removed from a strengthened clause: the list of such a lit is marked as dirty,
+// and the clauses that don't contain the lit anymore are dropped from it the next time it is traversed.
+
+// occLists are, for each lit, the list of clauses containing it, along with a queue of clauses
+// that must be checked for subsumption against the other clauses.
+type occLists struct {
+	pb    *Problem
+	lists [][]*Clause // For each lit, the clauses containing it, and maybe some removed clauses
+	dirty []bool      // For each lit, true iff a clause of its list might not contain it anymore
+	queue []*Clause   // Clauses that might subsume or strengthen another clause
+}
+
+// signature returns the signature of the vars of lits.
+func signature(lits []Lit) uint64 {
+	var sig uint64
+	for _, lit := range lits {
+		sig |= 1 << (uint(lit.Var()) % 64)
+	}
+	return sig
+}
+
+// newOccLists returns the occurrence lists of the clauses of pb. No clause is queued.
+func (pb *Problem) newOccLists() *occLists {
+	o := &occLists{pb: pb, lists: make([][]*Clause, 2*pb.NbVars), dirty: make([]bool, 2*pb.NbVars)}
+	for _, c := range pb.Clauses {
+		o.add(c)
+	}
+	return o
+}
+
+// add adds c to the lists.
+// The lits of c are sorted, since Subsumes expects sorted clauses.
+func (o *occLists) add(c *Clause) {
+	c.Sort()
+	c.sig = signature(c.lits)
+	c.removed = false
+	for _, lit := range c.lits {
+		o.lists[lit] = append(o.lists[lit], c)
+	}
+}
+
+// push queues c, unless it is already queued.
+func (o *occLists) push(c *Clause) {
+	if !c.queued {
+		c.queued = true
+		o.queue = append(o.queue, c)
+	}
+}
+
+// remove marks c as removed, and writes its deletion in the proof.
+func (o *occLists) remove(c *Clause) {
+	c.removed = true
+	o.pb.proofDelete(c.id, c.lits)
+}
+
+// list returns the clauses containing lit, after removed clauses were dropped from the list.
+func (o *occLists) list(lit Lit) []*Clause {
+	list := o.lists[lit]
+	dirty := o.dirty[lit]
+	n := 0
+	for _, c := range list {
+		if !c.removed && (!dirty || c.contains(lit)) {
+			list[n] = c
+			n++
+		}
+	}
+	for i := n; i < len(list); i++ {
+		list[i] = nil // So that the removed clauses can be garbage collected
+	}
+	o.lists[lit] = list[:n]
+	o.dirty[lit] = false
+	return o.lists[lit]
+}
+
+// contains returns true iff lit is one of the lits of c.
+func (c *Clause) contains(lit Lit) bool {
+	for _, lit2 := range c.lits {
+		if lit2 == lit {
+			return true
+		}
+	}
+	return false
+}
+
+// minLit returns the lit of c whose var appears in the least clauses.
+func (o *occLists) minLit(c *Clause) Lit {
+	best := c.lits[0]
+	nbBest := len(o.lists[best]) + len(o.lists[best.Negation()])
+	for _, lit := range c.lits[1:] {
+		if nb := len(o.lists[lit]) + len(o.lists[lit.Negation()]); nb < nbBest {
+			best, nbBest = lit, nb
+		}
+	}
+	return best
+}
+
+// subsume removes all the clauses that are subsumed by a queued clause, and strengthens all the clauses
+// that are self-subsumed by a queued clause, until the queue is empty or the problem is UNSAT.
+// A clause subsumed by c contains all its lits, and a clause self-subsumed by c contains all its lits but one,
+// whose negation it contains instead. So, given any lit of c, only the lists of that lit and of its negation must be traversed.
+// Strengthened clauses are queued again, since they might now subsume or strengthen other clauses.
+func (o *occLists) subsume() {
+	for len(o.queue) != 0 && o.pb.Status != Unsat {
+		c := o.queue[len(o.queue)-1]
+		o.queue = o.queue[:len(o.queue)-1]
+		c.queued = false
+		if c.removed || c.Len() == 0 {
+			continue
+		}
+		lit := o.minLit(c)
+		for _, d := range o.list(lit) {
+			if d == c || d.removed || d.Len() < c.Len() || c.sig&^d.sig != 0 {
+				continue
+			}
+			if c.Subsumes(d) {
+				o.remove(d)
+				o.pb.Stats.Subsumed++
+			} else if c.SelfSubsumes(d) {
+				o.strengthen(c, d)
+			}
+			if o.pb.Status == Unsat {
+				return
+			}
+		}
+		for _, d := range o.list(lit.Negation()) {
+			if d.removed || d.Len() < c.Len() || c.sig&^d.sig != 0 {
+				continue
+			}
+			if c.SelfSubsumes(d) {
+				o.strengthen(c, d)
+			}
+			if o.pb.Status == Unsat {
+				return
+			}
+		}
+	}
+}
+
+// strengthen removes from d the negation of the only lit of c whose negation is in d,
+// i.e d is replaced by its resolvent with c, which subsumes it.
+// In a QBF, the resolvent is only valid if the pivot is existential, and universal reduction is applied to it.
+// If d becomes a unit, it is removed from the clauses and its lit is bound.
+func (o *occLists) strengthen(c, d *Clause) {
+	pb := o.pb
+	var pivot Lit
+	for _, lit := range c.lits {
+		if d.contains(lit.Negation()) {
+			pivot = lit
+			break
+		}
+	}
+	if pb.isUniversal(pivot.Var()) {
+		return
+	}
+	old := append([]Lit(nil), d.lits...)
+	j := 0
+	for _, lit := range d.lits {
+		if lit != pivot.Negation() {
+			d.lits[j] = lit
+			j++
+		}
+	}
+	d.Shrink(j)
+	pb.reduceUniversals(d)
+	pb.Stats.Strengthened++
+	for _, lit := range old {
+		if !d.contains(lit) {
+			o.dirty[lit] = true
+		}
+	}
+	id := pb.proofAdd(d.lits, c.id, d.id)
+	pb.proofDelete(d.id, old)
+	d.id = id
+	d.sig = signature(d.lits)
+	switch d.Len() {
+	case 0:
+		pb.Status = Unsat
+	case 1:
+		o.unit(d)
+	default:
+		o.push(d)
+	}
+}
+
+// unit removes the unit clause c, and binds its lit.
+// The var might already be bound, if it was bound by a unit found earlier, since lists are not updated when a var is bound.
+func (o *occLists) unit(c *Clause) {
+	pb := o.pb
+	c.removed = true
+	lit := c.First()
+	switch {
+	case pb.Model[lit.Var()] == 0:
+		pb.addUnit(lit)
+		pb.setUnitID(lit, c.id)
+	case (pb.Model[lit.Var()] == 1) == lit.IsPositive():
+		pb.proofDelete(c.id, c.lits)
+	default:
+		pb.proofAdd(nil, c.id, pb.unitID(lit.Var()))
+		pb.Status = Unsat
+	}
+}
+
+// subsumeAndStrengthen runs subsumption and self-subsuming resolution to a fixpoint.
+// Each round ends with the propagation of the units that were found by strengthening,
+// which can remove or shorten clauses, so a new round is run until no unit is found.
+func (pb *Problem) subsumeAndStrengthen() {
+	for pb.Status == Undetermined {
+		round := Round{Subsumed: pb.Stats.Subsumed, Strengthened: pb.Stats.Strengthened, Units: len(pb.Units)}
+		o := pb.newOccLists()
+		for _, c := range pb.Clauses {
+			o.push(c)
+		}
+		o.subsume()
+		pb.dropRemoved()
+		if pb.Status != Unsat && len(pb.Units) != round.Units {
+			pb.Simplify2()
+		}
+		round.Subsumed = pb.Stats.Subsumed - round.Subsumed
+		round.Strengthened = pb.Stats.Strengthened - round.Strengthened
+		round.Units = len(pb.Units) - round.Units
+		pb.Stats.Rounds = append(pb.Stats.Rounds, round)
+		log.Printf("Round %d: %d clauses subsumed, %d lits removed by strengthening, %d units found",
+			len(pb.Stats.Rounds), round.Subsumed, round.Strengthened, round.Units)
+		if round.Units == 0 {
+			return
+		}
+	}
+}
+
+// dropRemoved removes the clauses that were marked as removed from pb.Clauses.
+func (pb *Problem) dropRemoved() {
+	nbKept := 0
+	for _, c := range pb.Clauses {
+		if !c.removed {
+			pb.Clauses[nbKept] = c
+			nbKept++
+		}
+	}
+	for i := nbKept; i < len(pb.Clauses); i++ {
+		pb.Clauses[i] = nil
+	}
+	pb.Clauses = pb.Clauses[:nbKept]
+}
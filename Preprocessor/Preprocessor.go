@@ -1,8 +1,8 @@
 package Preprocessor
 
 import (
-	"fmt"
 	"log"
+	"time"
 )
 
 //
@@ -11,34 +11,135 @@ import (
 
 type Status byte
 
+func (s Status) String() string {
+	switch s {
+	case Undetermined:
+		return "UNDETERMINED"
+	case Sat:
+		return "SAT"
+	case Unsat:
+		return "UNSAT"
+	default:
+		panic("invalid status")
+	}
+}
+
 // A Problem is a list of clauses & a number of vars.
 type Problem struct {
-	NbVars     int        // Total number of vars
-	Clauses    []*Clause  // List of non-empty, non-unit clauses
-	Status     Status     // Status of the problem. Can be trivially UNSAT (if empty clause was met or inferred by UP) or Indet.
-	Units      []Lit      // List of unit literal found in the problem.
-	Model      []decLevel // For each var, its inferred binding. 0 means unbound, 1 means bound to true, -1 means bound to false.
-	minLits    []Lit      // For an optimisation problem, the list of lits whose sum must be minimized
-	minWeights []int      // For an optimisation problem, the weight of each lit.
+	NbVars     int          // Total number of vars
+	Clauses    []*Clause    // List of clauses. Parsers keep units and empty clauses, Simplify2 removes them.
+	Xors       []*XorClause // List of xor constraints, with at least 2 vars.
+	Status     Status       // Status of the problem. Can be trivially UNSAT (if empty clause was met or inferred by UP) or Indet.
+	Units      []Lit        // List of unit literal found in the problem.
+	Model      []decLevel   // For each var, its inferred binding. 0 means unbound, 1 means bound to true, -1 means bound to false.
+	minLits    []Lit        // For an optimisation problem, the list of lits whose sum must be minimized
+	minWeights []int        // For an optimisation problem, the weight of each lit.
+	frozen     []bool       // For each var, true iff it must not be eliminated by the preprocessor.
+	Names      []string     // For problems built from a formula, the name of each named var. Other vars are not named.
+	Prefix     []QuantBlock // For a QBF, its quantifier prefix, from the outermost to the innermost block.
+	qlevels    []int        // For a QBF, the quantification level of each var.
+	stack      []StackEntry // Clauses removed by the preprocessor, needed to extend models of the simplified problem.
+	proof      *proofWriter // If not nil, where the proof of the modifications of the problem is written.
+	lastID     int          // ID of the last clause that was created.
+	unitIDs    []int        // When writing a proof, the ID of the unit clause that bound each var.
+	Stats      Stats        // Statistics about the last call to Preprocess.
+	Options    *Options     // Settings of the preprocessing techniques. If nil, DefaultOptions are used.
 }
 
-// CNF returns a DIMACS CNF representation of the problem.
-func (pb *Problem) CNF() string {
-	res := fmt.Sprintf("p cnf %d %d\n", pb.NbVars, len(pb.Clauses)+len(pb.Units))
-	for _, unit := range pb.Units {
-		res += fmt.Sprintf("%d 0\n", unit.Int())
+// Options are the settings of the preprocessing techniques.
+type Options struct {
+	Grow            int // Variable elimination can add at most this many clauses more than it removes
+	MaxResolventLen int // Vars are not eliminated if it yields a longer resolvent. If 0, there is no limit.
+	CoverEffort     int // Max nb of clause visits of covered clause elimination. If 0, it is not run.
+	ProbeLimit      int // Max nb of propagations of each round of failed literal probing. If 0, it is not run.
+}
+
+// DefaultOptions are the options used when a problem has no options.
+var DefaultOptions = Options{Grow: 0, MaxResolventLen: 20, CoverEffort: 1000000, ProbeLimit: 100000}
+
+// options returns the options of pb.
+func (pb *Problem) options() *Options {
+	if pb.Options == nil {
+		return &DefaultOptions
+	}
+	return pb.Options
+}
+
+// Optim returns true iff pb is an optimisation problem, ie
+// a problem for which we not only want to find a model, but also
+// the best possible model according to an optimization constraint.
+func (pb *Problem) Optim() bool {
+	return pb.minLits != nil
+}
+
+// SetCostFunc sets the function to minimize when optimizing the problem.
+// If all weights are 1, weights can be nil.
+// In all other cases, len(lits) must be the same as len(weights).
+// The vars of the cost function are frozen, since eliminating them would change the optimum.
+func (pb *Problem) SetCostFunc(lits []Lit, weights []int) {
+	if weights != nil && len(lits) != len(weights) {
+		panic("length of lits and of weights don't match")
+	}
+	pb.minLits = lits
+	pb.minWeights = weights
+	for _, lit := range lits {
+		pb.Freeze(lit.Var())
+	}
+}
+
+// Freeze marks v as a var that must survive preprocessing.
+func (pb *Problem) Freeze(v Var) {
+	if pb.frozen == nil {
+		pb.frozen = make([]bool, pb.NbVars)
 	}
-	for _, clause := range pb.Clauses {
-		res += fmt.Sprintf("%s\n", clause.CNF())
+	pb.frozen[v] = true
+}
+
+// newVar adds a fresh var to the problem and returns it.
+func (pb *Problem) newVar() Var {
+	v := Var(pb.NbVars)
+	pb.NbVars++
+	pb.Model = append(pb.Model, 0)
+	if pb.frozen != nil {
+		pb.frozen = append(pb.frozen, false)
 	}
-	return res
+	if pb.qlevels != nil {
+		pb.qlevels = append(pb.qlevels, 0)
+	}
+	if pb.unitIDs != nil {
+		pb.unitIDs = append(pb.unitIDs, 0)
+	}
+	return v
+}
+
+// isFrozen returns true iff v must not be eliminated.
+func (pb *Problem) isFrozen(v Var) bool {
+	return pb.frozen != nil && pb.frozen[v]
+}
+
+// CNF returns a DIMACS CNF representation of the problem, as written by WriteDIMACS.
+func (pb *Problem) CNF() string {
+	return toString(pb.WriteDIMACS)
+}
+
+// WCNF returns a weighted DIMACS representation of the problem, as written by WriteWCNF.
+func (pb *Problem) WCNF() string {
+	return toString(pb.WriteWCNF)
+}
+
+// minWeight returns the weight of the ith lit of the cost function.
+func (pb *Problem) minWeight(i int) int {
+	if pb.minWeights == nil {
+		return 1
+	}
+	return pb.minWeights[i]
 }
 
 ///// PROBLEM UTILITY FUNCTIONS FROM GOPHERSAT
 
 func (pb *Problem) updateStatus(nbClauses int) {
 	pb.Clauses = pb.Clauses[:nbClauses]
-	if pb.Status == Undetermined && nbClauses == 0 {
+	if pb.Status == Undetermined && nbClauses == 0 && len(pb.Xors) == 0 {
 		pb.Status = Sat
 	}
 }
@@ -64,11 +165,16 @@ func (pb *Problem) addUnit(lit Lit) {
 func (pb *Problem) Simplify2() {
 	nbClauses := len(pb.Clauses)
 	restart := true
+	var old []Lit // For the proof, lits of the clause before it was simplified
 	for restart {
 		restart = false
 		i := 0
 		for i < nbClauses {
 			c := pb.Clauses[i]
+			if pb.proof != nil {
+				old = append(old[:0], c.lits...)
+			}
+			origLen := c.Len()
 			nbLits := c.Len()
 			clauseSat := false
 			j := 0
@@ -84,27 +190,53 @@ func (pb *Problem) Simplify2() {
 					c.Set(j, c.Get(nbLits))
 				}
 			}
+			if !clauseSat && pb.QBF() { // Tautologies must be removed before universal reduction
+				c.Shrink(nbLits)
+				if c.Simplify() {
+					clauseSat = true
+				} else {
+					pb.reduceUniversals(c)
+					nbLits = c.Len()
+				}
+			}
 			if clauseSat {
+				pb.proofDelete(c.id, old)
 				nbClauses--
 				pb.Clauses[i] = pb.Clauses[nbClauses]
 			} else if nbLits == 0 {
+				pb.proofAdd(nil, pb.shrinkHints(c.id, old)...)
 				pb.Status = Unsat
 				return
 			} else if nbLits == 1 { // UP
+				id := c.id
+				if origLen > 1 { // The unit is new, and replaces the clause
+					id = pb.proofAdd(c.lits[:1], pb.shrinkHints(c.id, old)...)
+					pb.proofDelete(c.id, old)
+				}
 				pb.addUnit(c.First())
 				if pb.Status == Unsat {
 					return
 				}
+				pb.setUnitID(c.First(), id)
 				nbClauses--
 				pb.Clauses[i] = pb.Clauses[nbClauses]
 				restart = true // Must restart, since this lit might have made one more clause Unit or SAT.
 			} else { // nb lits unbound > cardinality
 				if c.Len() != nbLits {
 					c.Shrink(nbLits)
+					id := pb.proofAdd(c.lits, pb.shrinkHints(c.id, old)...)
+					pb.proofDelete(c.id, old)
+					c.id = id
 				}
 				i++
 			}
 		}
+		if pb.simplifyXors() {
+			restart = true
+		}
+		if pb.Status == Unsat {
+			return
+		}
 	}
 	pb.updateStatus(nbClauses)
 }
@@ -113,90 +245,95 @@ func (pb *Problem) Simplify2() {
 
 func (pb *Problem) Preprocess() {
 	log.Printf("Preprocessing... %d clauses currently", len(pb.Clauses))
-	occurs := make([][]int, pb.NbVars*2)
-	for i, c := range pb.Clauses {
-		for j := 0; j < c.Len(); j++ {
-			occurs[c.Get(j)] = append(occurs[c.Get(j)], i)
-		}
+	pb.Stats = Stats{Before: pb.size()}
+	nbUnits := len(pb.Units)
+	defer func() {
+		pb.Stats.Units = len(pb.Units) - nbUnits
+		pb.Stats.After = pb.size()
+		pb.Stats.Status = pb.Status.String()
+	}()
+	start := time.Now()
+	pb.Simplify2()
+	pb.Stats.phase("unit propagation", start)
+	if pb.Status == Unsat {
+		log.Printf("Inferred UNSAT")
+		return
 	}
-	modified := true
-	neverModified := true
-	for modified {
-		modified = false
-		for i := 0; i < pb.NbVars; i++ {
-			if pb.Model[i] != 0 {
-				continue
-			}
-			v := Var(i)
-			lit := v.Lit()
-			nbLit := len(occurs[lit])
-			nbLit2 := len(occurs[lit.Negation()])
-			// slow method is only effective with less than 10 literals
-			if (nbLit < 10 || nbLit2 < 10) && (nbLit != 0 || nbLit2 != 0) {
-				modified = true
-				neverModified = false
-				// pb.deleted[v] = true
-				log.Printf("%d can be removed: %d and %d", lit.Int(), len(occurs[lit]), len(occurs[lit.Negation()]))
-				for _, idx1 := range occurs[lit] {
-					for _, idx2 := range occurs[lit.Negation()] {
-						c1 := pb.Clauses[idx1]
-						c2 := pb.Clauses[idx2]
-						// generate new clause with self-subsuming resolution
-						newC := c1.Generate(c2, v)
-						if !newC.Simplify() {
-							switch newC.Len() {
-							case 0:
-								log.Printf("Inferred UNSAT")
-								pb.Status = Unsat
-								return
-							case 1:
-								log.Printf("Unit %d", newC.First().Int())
-								lit2 := newC.First()
-								if lit2.IsPositive() {
-									if pb.Model[lit2.Var()] == -1 {
-										pb.Status = Unsat
-										log.Printf("Inferred UNSAT")
-										return
-									}
-									pb.Model[lit2.Var()] = 1
-								} else {
-									if pb.Model[lit2.Var()] == 1 {
-										pb.Status = Unsat
-										log.Printf("Inferred UNSAT")
-										return
-									}
-									pb.Model[lit2.Var()] = -1
-								}
-								pb.Units = append(pb.Units, lit2)
-							default:
-								pb.Clauses = append(pb.Clauses, newC)
-							}
-						}
-					}
-				}
-				nbRemoved := 0
-				for _, idx := range occurs[lit] {
-					pb.Clauses[idx] = pb.Clauses[len(pb.Clauses)-nbRemoved-1]
-					nbRemoved++
-				}
-				for _, idx := range occurs[lit.Negation()] {
-					pb.Clauses[idx] = pb.Clauses[len(pb.Clauses)-nbRemoved-1]
-					nbRemoved++
-				}
-				pb.Clauses = pb.Clauses[:len(pb.Clauses)-nbRemoved]
-				log.Printf("clauses=%s", pb.CNF())
-				// Redo occurs
-				occurs = make([][]int, pb.NbVars*2)
-				for i, c := range pb.Clauses {
-					for j := 0; j < c.Len(); j++ {
-						occurs[c.Get(j)] = append(occurs[c.Get(j)], i)
-					}
-				}
-				continue
+	// tautologies must be removed first: resolving a tautology with itself would yield the empty clause
+	start = time.Now()
+	nbKept := 0
+	var old []Lit // For the proof, lits of the clause before duplicates were removed
+	for _, c := range pb.Clauses {
+		if pb.proof != nil {
+			old = append(old[:0], c.lits...)
+		}
+		n := c.Len()
+		if c.Simplify() {
+			pb.proofDelete(c.id, old)
+		} else {
+			if c.Len() != n {
+				id := pb.proofAdd(c.lits, c.id)
+				pb.proofDelete(c.id, old)
+				c.id = id
 			}
+			pb.Clauses[nbKept] = c
+			nbKept++
 		}
 	}
-	if !neverModified {
+	pb.Clauses = pb.Clauses[:nbKept]
+	pb.Stats.phase("tautologies", start)
+	// xors are kept as is, so their vars can't be eliminated, but they can still yield units
+	for _, x := range pb.Xors {
+		for _, v := range x.vars {
+			pb.Freeze(v)
+		}
+	}
+	if len(pb.Xors) != 0 {
+		start = time.Now()
+		if pb.gaussXors() {
+			pb.Simplify2()
+		}
+		pb.Stats.phase("gaussian elimination", start)
+	}
+	if pb.Status == Unsat {
+		log.Printf("Inferred UNSAT")
+		return
+	}
+	start = time.Now()
+	pb.substituteEquivalences()
+	pb.Stats.phase("equivalent literals", start)
+	if pb.Status == Unsat {
+		log.Printf("Inferred UNSAT")
+		return
+	}
+	start = time.Now()
+	pb.probeFailedLits()
+	pb.Stats.phase("failed literal probing", start)
+	if pb.Status == Unsat {
+		log.Printf("Inferred UNSAT")
+		return
+	}
+	start = time.Now()
+	pb.subsumeAndStrengthen()
+	pb.Stats.phase("subsumption and strengthening", start)
+	if pb.Status == Unsat {
+		log.Printf("Inferred UNSAT")
+		return
+	}
+	start = time.Now()
+	pb.eliminateBlocked()
+	pb.Stats.phase("blocked clause elimination", start)
+	start = time.Now()
+	pb.eliminateCovered()
+	pb.Stats.phase("covered clause elimination", start)
+	start = time.Now()
+	nbEliminated := pb.eliminateVars()
+	pb.Stats.phase("variable elimination", start)
+	if pb.Status == Unsat {
+		log.Printf("Inferred UNSAT")
+		return
+	}
+	if nbEliminated != 0 {
 		pb.Simplify2()
 	}
 	log.Printf("Done. %d clauses now", len(pb.Clauses))
@@ -0,0 +1,314 @@
+package Preprocessor
+
+import "log"
+
+// FAILED LITERAL PROBING WITH LIFTING, INSPIRED BY http://fmv.jku.at/papers/Biere-SAT11.pdf (section on lifting)
+// A lit l is probed by assigning it and running unit propagation. If a conflict is found, l is a failed lit,
+// and -l is a unit. Otherwise, -l is probed too, and the lits implied by both l and -l are lifted:
+//   - if x is implied by both, x is a unit, derived from the clauses (-l x) and (l x);
+//   - if x is implied by l, and -x by -l, then l and x are equivalent. The binary clauses (-l x) and (l -x)
+//     are added to the problem, and the equivalence is then substituted like the other ones.
+// Probing every var would be too costly, so the roots of the binary implication graph are probed first,
+// i.e lits that imply other lits but are not implied by any, since their propagation covers the most lits.
+// Since the negation of a root implies nothing, lifting is only useful for vars whose lits both imply other lits,
+// which are probed next.
+// Each round of probing is stopped after Options.ProbeLimit propagations, and a new round starts, with
+// the simplified problem, as long as the previous one found units or equivalences.
+// The propagations of a probe are the hints of the derivations in LRAT proofs. Probing is not done on QBFs.
+
+// A prober probes lits of a problem. Values of probed lits are written in the model of the problem,
+// and reset once the probe is over.
+type prober struct {
+	pb      *Problem
+	occs    [][]*Clause // For each lit, the clauses containing it
+	trail   []Lit       // Lits assigned by the current probe, and units found during this round
+	reasons []*Clause   // For each lit of the trail, the clause that implied it, or nil
+	probing bool        // True iff lits are assigned by a probe, and not as units
+	effort  int         // Nb of propagations that remain in the round
+	seen    []bool      // For each var, true iff the ID of its unit is already among the hints
+	implied []int       // For each lit, 1 + its index among the lits implied by the previous probe, or 0
+}
+
+// newProber returns a prober of the clauses of pb.
+func (pb *Problem) newProber() *prober {
+	p := &prober{
+		pb:      pb,
+		occs:    make([][]*Clause, 2*pb.NbVars),
+		effort:  pb.options().ProbeLimit,
+		seen:    make([]bool, pb.NbVars),
+		implied: make([]int, 2*pb.NbVars),
+	}
+	for _, c := range pb.Clauses {
+		for _, lit := range c.lits {
+			p.occs[lit] = append(p.occs[lit], c)
+		}
+	}
+	return p
+}
+
+// value returns 1 if lit is true, -1 if it is false, and 0 if it is unassigned.
+func (p *prober) value(lit Lit) int {
+	val := int(p.pb.Model[lit.Var()])
+	if !lit.IsPositive() {
+		return -val
+	}
+	return val
+}
+
+// assign makes lit true, because of reason. Outside of a probe, lit is a new unit.
+func (p *prober) assign(lit Lit, reason *Clause) {
+	pb := p.pb
+	if !p.probing && reason != nil {
+		pb.setUnitID(lit, pb.proofAdd([]Lit{lit}, pb.shrinkHints(reason.id, reason.lits)...))
+	}
+	if lit.IsPositive() {
+		pb.Model[lit.Var()] = 1
+	} else {
+		pb.Model[lit.Var()] = -1
+	}
+	p.trail = append(p.trail, lit)
+	p.reasons = append(p.reasons, reason)
+	if !p.probing {
+		pb.Units = append(pb.Units, lit)
+	}
+}
+
+// undo unassigns the lits of the trail after the nth one.
+func (p *prober) undo(n int) {
+	for _, lit := range p.trail[n:] {
+		p.pb.Model[lit.Var()] = 0
+	}
+	p.trail = p.trail[:n]
+	p.reasons = p.reasons[:n]
+}
+
+// propagate propagates the lits of the trail, from the nth one on. It returns the falsified clause, if any.
+func (p *prober) propagate(n int) *Clause {
+	for ; n < len(p.trail); n++ {
+		p.effort--
+		for _, c := range p.occs[p.trail[n].Negation()] {
+			var free Lit = -1
+			nbFree := 0
+			sat := false
+			for _, lit := range c.lits {
+				switch p.value(lit) {
+				case 1:
+					sat = true
+				case 0:
+					free = lit
+					nbFree++
+				}
+				if sat || nbFree > 1 {
+					break
+				}
+			}
+			switch {
+			case sat || nbFree > 1:
+			case nbFree == 0:
+				return c
+			default:
+				p.assign(free, c)
+			}
+		}
+	}
+	return nil
+}
+
+// probe assigns lit and propagates it. It returns the falsified clause, if any.
+// The caller must then undo the probe.
+func (p *prober) probe(lit Lit) *Clause {
+	p.probing = true
+	n := len(p.trail)
+	p.assign(lit, nil)
+	return p.propagate(n)
+}
+
+// hints returns the hints deriving a clause from the propagation of a probe that implied the given reasons,
+// and, if conflict is not nil, falsified conflict: the IDs of the units that falsified lits of those clauses,
+// and then the clauses themselves. It must be called once the probe was undone.
+func (p *prober) hints(reasons []*Clause, conflict *Clause) []int {
+	pb := p.pb
+	if pb.proof == nil {
+		return nil
+	}
+	var hints []int
+	clauses := reasons
+	if conflict != nil {
+		clauses = append(clauses[:len(clauses):len(clauses)], conflict)
+	}
+	for _, c := range clauses {
+		for _, lit := range c.lits {
+			if v := lit.Var(); pb.Model[v] != 0 && !p.seen[v] {
+				p.seen[v] = true
+				hints = append(hints, pb.unitID(v))
+			}
+		}
+	}
+	for _, c := range clauses {
+		for _, lit := range c.lits {
+			p.seen[lit.Var()] = false
+		}
+		hints = append(hints, c.id)
+	}
+	return hints
+}
+
+// learn adds the unit lit, derived with the given hints, and propagates it.
+func (p *prober) learn(lit Lit, hints []int) {
+	pb := p.pb
+	p.probing = false
+	id := pb.proofAdd([]Lit{lit}, hints...)
+	n := len(p.trail)
+	p.assign(lit, nil)
+	pb.setUnitID(lit, id)
+	if c := p.propagate(n); c != nil {
+		pb.proofAdd(nil, pb.shrinkHints(c.id, c.lits)...)
+		pb.Status = Unsat
+	}
+}
+
+// candidates returns the lits to probe. First come the roots of the binary implication graph, i.e the lits l
+// such that -l appears in a binary clause, but l doesn't: if a lit fails, so do the roots implying it.
+// Then come the vars whose lits both imply other lits, since only their probes can be lifted.
+func (p *prober) candidates() []Lit {
+	pb := p.pb
+	inBinary := make([]bool, 2*pb.NbVars)
+	for _, c := range pb.Clauses {
+		if c.Len() == 2 {
+			inBinary[c.lits[0]] = true
+			inBinary[c.lits[1]] = true
+		}
+	}
+	var roots, twoSided []Lit
+	for lit := range inBinary {
+		switch neg := Lit(lit).Negation(); {
+		case inBinary[neg] && !inBinary[lit]:
+			roots = append(roots, Lit(lit))
+		case inBinary[neg] && Lit(lit).IsPositive():
+			twoSided = append(twoSided, Lit(lit))
+		}
+	}
+	return append(roots, twoSided...)
+}
+
+// A lifted is a unit or an equivalence found by lifting, with the hints deriving (-l x) and (l x)
+// for a unit x, or (-l -x) and (l x) for an equivalence between l and x, where l is the probed lit.
+type lifted struct {
+	lit   Lit
+	hints [2][]int
+}
+
+// probeVar probes lit and -lit, and learns the failed lits and the lifted units.
+// It returns the binary clauses of the lifted equivalences.
+func (p *prober) probeVar(lit Lit) (equivs []*Clause) {
+	pb := p.pb
+	n := len(p.trail)
+	if c := p.probe(lit); c != nil {
+		reasons := append([]*Clause(nil), p.reasons[n+1:]...)
+		p.undo(n)
+		p.learn(lit.Negation(), p.hints(reasons, c))
+		pb.Stats.FailedLits++
+		return nil
+	}
+	pos := append([]Lit(nil), p.trail[n+1:]...)
+	posReasons := append([]*Clause(nil), p.reasons[n+1:]...)
+	p.undo(n)
+	c := p.probe(lit.Negation())
+	neg := append([]Lit(nil), p.trail[n+1:]...)
+	negReasons := append([]*Clause(nil), p.reasons[n+1:]...)
+	p.undo(n)
+	if c != nil {
+		p.learn(lit, p.hints(negReasons, c))
+		pb.Stats.FailedLits++
+		return nil
+	}
+	// Units and equivalences are all found before being learnt, since learning units changes the model
+	for i, lit2 := range pos {
+		p.implied[lit2] = i + 1
+	}
+	var units, eqs []lifted
+	for i, lit2 := range neg {
+		j := p.implied[lit2] - 1
+		isUnit := j >= 0
+		if !isUnit {
+			j = p.implied[lit2.Negation()] - 1
+			if j < 0 || pb.isFrozen(lit.Var()) && pb.isFrozen(lit2.Var()) { // Frozen vars would not be substituted
+				continue
+			}
+		}
+		l := lifted{lit: lit2}
+		if pb.proof != nil {
+			l.hints = [2][]int{p.hints(posReasons[:j+1], nil), p.hints(negReasons[:i+1], nil)}
+		}
+		if isUnit {
+			units = append(units, l)
+		} else {
+			eqs = append(eqs, l)
+		}
+	}
+	for _, lit2 := range pos {
+		p.implied[lit2] = 0
+	}
+	for _, u := range units {
+		x := u.lit
+		if pb.Status == Unsat || pb.Model[x.Var()] != 0 {
+			continue
+		}
+		c1 := []Lit{lit.Negation(), x}
+		c2 := []Lit{lit, x}
+		id1 := pb.proofAdd(c1, u.hints[0]...)
+		id2 := pb.proofAdd(c2, u.hints[1]...)
+		p.learn(x, []int{id1, id2})
+		pb.proofDelete(id1, c1)
+		pb.proofDelete(id2, c2)
+		pb.Stats.LiftedUnits++
+	}
+	for _, eq := range eqs {
+		x := eq.lit // lit => -x and -lit => x
+		c1 := NewClause([]Lit{lit.Negation(), x.Negation()})
+		c1.id = pb.proofAdd(c1.lits, eq.hints[0]...)
+		c2 := NewClause([]Lit{lit, x})
+		c2.id = pb.proofAdd(c2.lits, eq.hints[1]...)
+		equivs = append(equivs, c1, c2)
+		pb.Stats.LiftedEquivs++
+	}
+	return equivs
+}
+
+// probeRound probes the candidates, until the effort is exhausted.
+// It returns true iff units or equivalences were found.
+func (pb *Problem) probeRound() bool {
+	p := pb.newProber()
+	nbUnits := len(pb.Units)
+	var equivs []*Clause
+	for _, lit := range p.candidates() {
+		if p.effort <= 0 || pb.Status == Unsat {
+			break
+		}
+		if pb.Model[lit.Var()] == 0 {
+			equivs = append(equivs, p.probeVar(lit)...)
+		}
+	}
+	if pb.Status == Unsat {
+		return false
+	}
+	pb.Clauses = append(pb.Clauses, equivs...)
+	if len(pb.Units) != nbUnits {
+		pb.Simplify2()
+	}
+	if len(equivs) != 0 && pb.Status != Unsat {
+		pb.substituteEquivalences()
+	}
+	return len(pb.Units) != nbUnits || len(equivs) != 0
+}
+
+// probeFailedLits runs rounds of probing until no new unit or equivalence is found.
+func (pb *Problem) probeFailedLits() {
+	if pb.QBF() || pb.options().ProbeLimit <= 0 {
+		return
+	}
+	for round := 1; pb.probeRound() && pb.Status != Unsat; round++ {
+		log.Printf("Probing round %d: %d failed lits, %d lifted units, %d lifted equivalences",
+			round, pb.Stats.FailedLits, pb.Stats.LiftedUnits, pb.Stats.LiftedEquivs)
+	}
+}
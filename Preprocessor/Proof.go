@@ -0,0 +1,181 @@
+package Preprocessor
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+)
+
+// DRAT AND LRAT PROOFS OF THE PREPROCESSING STEPS
+// Every clause added or deleted by the preprocessor is written to the proof, so that a DRAT proof
+// produced by a solver on the simplified problem can be appended to it, giving a proof for the original problem.
+// In LRAT, clauses are identified by their ID: clauses of the original problem are numbered from 1 in the order
+// they were parsed, and each added clause gets the next ID. Each added clause comes with hints, i.e
+// the IDs of the clauses that become unit, and then falsified, when its lits are falsified:
+// - a clause shrunk by unit propagation has the units of its false lits, then the original clause, as hints;
+// - a resolvent has the clause containing the positive lit of the eliminated var, then the one containing its negation;
+// - a clause strengthened by self-subsumption has the strengthening clause, then the original clause.
+// Proofs are only meaningful for pure CNF problems, i.e problems without quantifiers nor xor constraints.
+
+// ProofFormat is the format of a proof.
+type ProofFormat byte
+
+const (
+	// DRAT is the textual DRAT format.
+	DRAT = ProofFormat(iota)
+	// BinaryDRAT is the binary DRAT format.
+	BinaryDRAT
+	// LRAT is the textual LRAT format, with clause IDs and hints.
+	LRAT
+)
+
+// A proofWriter writes proofs in the given format.
+type proofWriter struct {
+	*bufio.Writer
+	format ProofFormat
+	buf    []byte
+}
+
+// SetProof makes pb write a proof of all its modifications to w, in the given format.
+// It must be called before the problem is modified, and FlushProof must be called once preprocessing is over.
+func (pb *Problem) SetProof(w io.Writer, format ProofFormat) {
+	pb.proof = &proofWriter{Writer: bufio.NewWriterSize(w, 64*1024), format: format}
+	if pb.unitIDs == nil {
+		pb.unitIDs = make([]int, pb.NbVars)
+	}
+}
+
+// FlushProof writes the proof data that is still buffered, if any,
+// and returns the first error that happened while writing the proof.
+func (pb *Problem) FlushProof() error {
+	if pb.proof == nil {
+		return nil
+	}
+	return pb.proof.Flush()
+}
+
+// newID returns the ID of a new clause.
+func (pb *Problem) newID() int {
+	pb.lastID++
+	return pb.lastID
+}
+
+// addClause adds a new clause made of lits to pb.
+func (pb *Problem) addClause(lits []Lit) {
+	c := NewClause(lits)
+	c.id = pb.newID()
+	pb.Clauses = append(pb.Clauses, c)
+}
+
+// setUnitID records that the unit lit, whose var was just bound, comes from the clause with the given ID.
+func (pb *Problem) setUnitID(lit Lit, id int) {
+	if pb.unitIDs != nil {
+		pb.unitIDs[lit.Var()] = id
+	}
+}
+
+// unitID returns the ID of the unit clause that bound v, or 0 if it is unknown.
+func (pb *Problem) unitID(v Var) int {
+	if pb.unitIDs == nil {
+		return 0
+	}
+	return pb.unitIDs[v]
+}
+
+// shrinkHints returns the hints of the clause obtained by removing the false lits from the clause
+// with the given ID and lits: the units that falsify them, each var only once, and then the clause itself.
+func (pb *Problem) shrinkHints(id int, lits []Lit) []int {
+	if pb.proof == nil {
+		return nil
+	}
+	var hints []int
+	for _, lit := range lits {
+		if pb.Model[lit.Var()] == 0 {
+			continue
+		}
+		uid := pb.unitIDs[lit.Var()]
+		dup := false
+		for _, hint := range hints {
+			if hint == uid {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			hints = append(hints, uid)
+		}
+	}
+	return append(hints, id)
+}
+
+// proofAdd returns the ID of the new clause made of lits, and writes its addition in the proof, if any.
+// hints are only used in LRAT.
+func (pb *Problem) proofAdd(lits []Lit, hints ...int) int {
+	id := pb.newID()
+	if pb.proof != nil {
+		pb.proof.write(false, id, lits, hints)
+	}
+	return id
+}
+
+// proofDelete writes the deletion of the clause with the given ID and lits in the proof, if any.
+func (pb *Problem) proofDelete(id int, lits []Lit) {
+	if pb.proof != nil {
+		pb.proof.write(true, pb.lastID, lits, []int{id})
+	}
+}
+
+// write writes a line of the proof.
+// In LRAT, an addition is written as "id lits 0 hints 0", and a deletion as "id d deletedID 0".
+// In binary DRAT, each lit is encoded as 2*v+sign with a variable-length encoding, and the clause ends with a 0 byte.
+func (p *proofWriter) write(deletion bool, id int, lits []Lit, hints []int) {
+	buf := p.buf[:0]
+	switch p.format {
+	case BinaryDRAT:
+		if deletion {
+			buf = append(buf, 'd')
+		} else {
+			buf = append(buf, 'a')
+		}
+		for _, lit := range lits {
+			u := uint32(lit.Var()+1) << 1
+			if !lit.IsPositive() {
+				u |= 1
+			}
+			for u > 127 {
+				buf = append(buf, byte(u&127)|128)
+				u >>= 7
+			}
+			buf = append(buf, byte(u))
+		}
+		buf = append(buf, 0)
+	case DRAT:
+		if deletion {
+			buf = append(buf, "d "...)
+		}
+		for _, lit := range lits {
+			buf = strconv.AppendInt(buf, int64(lit.Int()), 10)
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, "0\n"...)
+	case LRAT:
+		buf = strconv.AppendInt(buf, int64(id), 10)
+		buf = append(buf, ' ')
+		if deletion {
+			buf = append(buf, "d "...)
+		} else {
+			for _, lit := range lits {
+				buf = strconv.AppendInt(buf, int64(lit.Int()), 10)
+				buf = append(buf, ' ')
+			}
+			buf = append(buf, "0 "...)
+		}
+		for _, hint := range hints {
+			buf = strconv.AppendInt(buf, int64(hint), 10)
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, "0\n"...)
+	}
+	p.Write(buf)
+	p.buf = buf
+}
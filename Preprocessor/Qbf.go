@@ -0,0 +1,92 @@
+package Preprocessor
+
+// QBF SUPPORT: QUANTIFIER PREFIX, UNIVERSAL REDUCTION AND QDIMACS OUTPUT
+
+// A QuantBlock is a block of vars sharing the same quantifier in the prefix of a QBF.
+type QuantBlock struct {
+	Universal bool // true for a "a" block, false for a "e" block
+	Vars      []Var
+}
+
+// QBF returns true iff pb has a quantifier prefix.
+func (pb *Problem) QBF() bool {
+	return pb.Prefix != nil
+}
+
+// addQuantBlock appends vars to the prefix, merging them with the last block if it has the same quantifier.
+func (pb *Problem) addQuantBlock(universal bool, vars []Var) {
+	if n := len(pb.Prefix); n != 0 && pb.Prefix[n-1].Universal == universal {
+		pb.Prefix[n-1].Vars = append(pb.Prefix[n-1].Vars, vars...)
+		return
+	}
+	pb.Prefix = append(pb.Prefix, QuantBlock{Universal: universal, Vars: vars})
+}
+
+// initQuantLevels computes the quantification level of each var.
+// Vars that don't appear in the prefix are free, i.e existentially quantified at the outermost level 0.
+// Vars from the ith block of the prefix have level i+1.
+func (pb *Problem) initQuantLevels() {
+	pb.qlevels = make([]int, pb.NbVars)
+	for i, block := range pb.Prefix {
+		for _, v := range block.Vars {
+			pb.qlevels[v] = i + 1
+		}
+	}
+}
+
+// isUniversal returns true iff v is universally quantified.
+func (pb *Problem) isUniversal(v Var) bool {
+	if pb.qlevels == nil || pb.qlevels[v] == 0 {
+		return false
+	}
+	return pb.Prefix[pb.qlevels[v]-1].Universal
+}
+
+// innermostExistential returns true iff v is existentially quantified in the innermost existential block.
+// Those are the only vars that can be eliminated by resolution in a QBF.
+// In a propositional problem, all vars are innermost existential vars.
+func (pb *Problem) innermostExistential(v Var) bool {
+	if !pb.QBF() {
+		return true
+	}
+	if pb.isUniversal(v) {
+		return false
+	}
+	innermost := 0
+	for i, block := range pb.Prefix {
+		if !block.Universal {
+			innermost = i + 1
+		}
+	}
+	return pb.qlevels[v] == innermost
+}
+
+// reduceUniversals applies universal reduction to c: universal lits that are not followed in the prefix
+// by any existential lit of c are removed, since the universal player can always falsify them.
+// Does nothing if pb is not a QBF.
+func (pb *Problem) reduceUniversals(c *Clause) {
+	if !pb.QBF() {
+		return
+	}
+	maxExist := -1 // Level of the innermost existential lit of c
+	for _, lit := range c.lits {
+		if v := lit.Var(); !pb.isUniversal(v) && pb.qlevels[v] > maxExist {
+			maxExist = pb.qlevels[v]
+		}
+	}
+	j := 0
+	for i, lit := range c.lits {
+		if v := lit.Var(); !pb.isUniversal(v) || pb.qlevels[v] < maxExist {
+			c.lits[j] = c.lits[i]
+			j++
+		}
+	}
+	if j != c.Len() {
+		c.Shrink(j)
+	}
+}
+
+// QDIMACS returns a QDIMACS representation of the problem, as written by WriteQDIMACS.
+func (pb *Problem) QDIMACS() string {
+	return toString(pb.WriteQDIMACS)
+}
@@ -0,0 +1,155 @@
+package Preprocessor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MODEL RECONSTRUCTION: CLAUSES REMOVED BY THE PREPROCESSOR ARE KEPT ON A STACK, WITH A WITNESS LIT,
+// SO THAT A MODEL OF THE SIMPLIFIED PROBLEM CAN BE EXTENDED TO A MODEL OF THE ORIGINAL ONE.
+
+// A StackEntry is a clause that was removed from the problem, along with its witness,
+// i.e a lit of the clause that can be set to true to satisfy it without falsifying
+// any clause still in the problem or removed after it.
+// When a var is eliminated, its clauses are pushed with the lit of the var as witness;
+// blocked and covered clauses are pushed with their blocking lit.
+type StackEntry struct {
+	Witness Lit
+	Clause  []Lit // Lits of the removed clause, including the witness
+}
+
+// A Stack is the list of removed clauses, in the order they were removed.
+// It is written as a "p stack nbvars nbentries" header, followed by one line per entry,
+// containing the lits of the clause, witness first, terminated by a 0.
+type Stack struct {
+	NbVars  int
+	Entries []StackEntry
+}
+
+// push records that c was removed from pb, with the given witness.
+func (pb *Problem) push(witness Lit, c *Clause) {
+	pb.stack = append(pb.stack, StackEntry{Witness: witness, Clause: append([]Lit(nil), c.lits...)})
+}
+
+// WriteStack writes the reconstruction stack of pb to w.
+// It must be called before the problem is compacted, since the stack uses the original vars.
+func (pb *Problem) WriteStack(w io.Writer) error {
+	st := &Stack{NbVars: pb.NbVars, Entries: pb.stack}
+	return st.Write(w)
+}
+
+// Write writes the stack to w.
+func (st *Stack) Write(w io.Writer) error {
+	fw := newFormulaWriter(w)
+	fw.header("stack", st.NbVars, len(st.Entries))
+	for _, e := range st.Entries {
+		fw.int(int64(e.Witness.Int()))
+		fw.WriteByte(' ')
+		for _, lit := range e.Clause {
+			if lit != e.Witness {
+				fw.int(int64(lit.Int()))
+				fw.WriteByte(' ')
+			}
+		}
+		fw.WriteString("0\n")
+	}
+	return fw.Flush()
+}
+
+// ParseStack reads a stack written by Stack.Write.
+func ParseStack(f io.Reader) (*Stack, error) {
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024*1024)
+	var (
+		st        *Stack
+		nbEntries = 0
+		lineNb    = 0
+	)
+	for sc.Scan() {
+		lineNb++
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || fields[0][0] == 'c' {
+			continue
+		}
+		if fields[0] == "p" {
+			if st != nil {
+				return nil, fmt.Errorf("line %d: duplicate header", lineNb)
+			}
+			if len(fields) != 4 || fields[1] != "stack" {
+				return nil, fmt.Errorf("line %d: invalid syntax %q in header", lineNb, strings.Join(fields, " "))
+			}
+			nbVars, err := strconv.Atoi(fields[2])
+			if err != nil || nbVars < 0 {
+				return nil, fmt.Errorf("line %d: nbvars not a positive int : %q", lineNb, fields[2])
+			}
+			if nbEntries, err = strconv.Atoi(fields[3]); err != nil || nbEntries < 0 {
+				return nil, fmt.Errorf("line %d: nbentries not a positive int : %q", lineNb, fields[3])
+			}
+			st = &Stack{NbVars: nbVars, Entries: make([]StackEntry, 0, nbEntries)}
+			continue
+		}
+		if st == nil {
+			return nil, fmt.Errorf("line %d: entry found before header", lineNb)
+		}
+		if len(fields) < 2 || fields[len(fields)-1] != "0" {
+			return nil, fmt.Errorf("line %d: entry does not end with 0", lineNb)
+		}
+		lits := make([]Lit, 0, len(fields)-1)
+		for _, field := range fields[:len(fields)-1] {
+			val, err := strconv.ParseInt(field, 10, 32)
+			if err != nil || val == 0 || val > int64(st.NbVars) || -val > int64(st.NbVars) {
+				return nil, fmt.Errorf("line %d: invalid literal %q", lineNb, field)
+			}
+			lits = append(lits, IntToLit(int32(val)))
+		}
+		st.Entries = append(st.Entries, StackEntry{Witness: lits[0], Clause: lits})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("could not read stack: %v", err)
+	}
+	if st == nil {
+		return nil, fmt.Errorf("no header found")
+	}
+	if len(st.Entries) != nbEntries {
+		return nil, fmt.Errorf("header declares %d entries, but %d were found", nbEntries, len(st.Entries))
+	}
+	return st, nil
+}
+
+// Extend extends a model of the simplified problem to a model of the original problem.
+// Vars that don't appear in the model are first set to false; then the stack is traversed
+// from the last removed clause to the first one, and the witness of each falsified clause is set to true.
+// The result has one lit per var.
+func (st *Stack) Extend(model []Lit) ([]Lit, error) {
+	values := make([]bool, st.NbVars)
+	for _, lit := range model {
+		if int(lit.Var()) >= st.NbVars {
+			return nil, fmt.Errorf("invalid var %d in model of a problem with %d vars", lit.Var().Lit().Int(), st.NbVars)
+		}
+		values[lit.Var()] = lit.IsPositive()
+	}
+	for i := len(st.Entries) - 1; i >= 0; i-- {
+		e := st.Entries[i]
+		sat := false
+		for _, lit := range e.Clause {
+			if values[lit.Var()] == lit.IsPositive() {
+				sat = true
+				break
+			}
+		}
+		if !sat {
+			values[e.Witness.Var()] = e.Witness.IsPositive()
+		}
+	}
+	res := make([]Lit, st.NbVars)
+	for i, val := range values {
+		res[i] = Var(i).Lit()
+		if !val {
+			res[i] = res[i].Negation()
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,100 @@
+package Preprocessor
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// STATISTICS ABOUT THE PREPROCESSING OF A PROBLEM, MEANT TO BE WRITTEN AS JSON
+
+// Stats are statistics about the last call to Preprocess.
+type Stats struct {
+	File           string  `json:"file,omitempty"` // Set by the caller, if relevant
+	Before         Size    `json:"before"`
+	After          Size    `json:"after"`
+	Subsumed       int     `json:"subsumed"`            // Nb of clauses removed because they were subsumed
+	Strengthened   int     `json:"strengthened"`        // Nb of lits removed by self-subsuming resolution
+	Rounds         []Round `json:"subsumption_rounds"`  // Details of each round of subsumption and strengthening
+	Substituted    int     `json:"substituted_vars"`    // Nb of vars replaced by an equivalent lit
+	FailedLits     int     `json:"failed_lits"`         // Nb of units found because their negation failed when probed
+	LiftedUnits    int     `json:"lifted_units"`        // Nb of units implied by both polarities of a probed var
+	LiftedEquivs   int     `json:"lifted_equivalences"` // Nb of equivalences found by probing both polarities of a var
+	Blocked        int     `json:"blocked"`             // Nb of blocked clauses that were removed
+	Covered        int     `json:"covered"`             // Nb of covered or asymmetric clauses that were removed
+	EliminatedVars int     `json:"eliminated_vars"`     // Nb of vars removed by variable elimination
+	Gates          Gates   `json:"gates"`               // Definitions used to eliminate vars
+	Units          int     `json:"units"`               // Nb of units found
+	Phases         []Phase `json:"phases"`
+	Status         string  `json:"status"`
+}
+
+// A Size describes the size of a problem. Units count as clauses of length 1.
+type Size struct {
+	Vars    int   `json:"vars"` // Nb of unbound vars appearing in a clause or a xor constraint
+	Clauses int   `json:"clauses"`
+	Lits    int   `json:"lits"`
+	Lengths []int `json:"lengths"` // For each length, the nb of clauses of that length
+}
+
+// A Round is a round of subsumption and self-subsuming resolution, followed by unit propagation.
+type Round struct {
+	Subsumed     int `json:"subsumed"`
+	Strengthened int `json:"strengthened"`
+	Units        int `json:"units"` // Nb of units found by strengthening and propagated at the end of the round
+}
+
+// A Phase is a step of the preprocessing, with its wall time.
+type Phase struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+}
+
+// size returns the current size of pb.
+// An UNSAT problem is the empty clause, as written by WriteDIMACS, whatever its clauses were when UNSAT was inferred.
+func (pb *Problem) size() Size {
+	if pb.Status == Unsat {
+		return Size{Clauses: 1, Lengths: []int{1}}
+	}
+	s := Size{Clauses: len(pb.Clauses) + len(pb.Units), Lits: len(pb.Units)}
+	used := make([]bool, pb.NbVars)
+	count := func(length int) {
+		for len(s.Lengths) <= length {
+			s.Lengths = append(s.Lengths, 0)
+		}
+		s.Lengths[length]++
+	}
+	for range pb.Units {
+		count(1)
+	}
+	for _, c := range pb.Clauses {
+		s.Lits += c.Len()
+		count(c.Len())
+		for _, lit := range c.lits {
+			used[lit.Var()] = true
+		}
+	}
+	for _, x := range pb.Xors {
+		for _, v := range x.vars {
+			used[v] = true
+		}
+	}
+	for v, u := range used {
+		if u && pb.Model[v] == 0 {
+			s.Vars++
+		}
+	}
+	return s
+}
+
+// phase records that the phase with the given name, started at start, is over.
+func (st *Stats) phase(name string, start time.Time) {
+	st.Phases = append(st.Phases, Phase{Name: name, Seconds: time.Since(start).Seconds()})
+}
+
+// WriteJSON writes the stats to w, as an indented JSON object.
+func (st *Stats) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(st)
+}
@@ -0,0 +1,29 @@
+package Preprocessor
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStatsUnsat(t *testing.T) {
+	data, err := ioutil.ReadFile("small.cnf")
+	if err != nil {
+		t.Fatalf("could not read instance: %v", err)
+	}
+	pb, err := ParseCNF(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("could not parse instance: %v", err)
+	}
+	pb.Preprocess()
+	if pb.Stats.Status != "UNSAT" {
+		t.Fatalf("expected UNSAT, got %s", pb.Stats.Status)
+	}
+	if want := (Size{Clauses: 1, Lengths: []int{1}}); !reflect.DeepEqual(pb.Stats.After, want) {
+		t.Errorf("expected size after preprocessing %+v, got %+v", want, pb.Stats.After)
+	}
+	if pb.Stats.Before.Clauses == 0 {
+		t.Errorf("size before preprocessing was not recorded")
+	}
+}
@@ -1,13 +1,14 @@
 package Preprocessor
 
 import (
-	"fmt"
 	"sort"
+	"strconv"
 )
 
 type decLevel int
 type Lit int32
 type Var int32
+
 const (
 	// Indet means the problem is not proven sat or unsat yet.
 	Undetermined = Status(iota)
@@ -28,8 +29,13 @@ type pbData struct {
 
 // clause structure
 type Clause struct {
-	lits []Lit
-	pbData   *pbData
+	lits    []Lit
+	pbData  *pbData
+	id      int    // Unique ID of the clause, used in LRAT proofs
+	sig     uint64 // Signature of the vars of the clause, see occLists
+	removed bool   // True iff the clause was removed while occurrence lists were in use
+	queued  bool   // True iff the clause is in the subsumption queue
+	gate    bool   // True iff the clause is part of the definition of the var being eliminated
 }
 
 // First returns the first literal from the clause.
@@ -48,7 +54,7 @@ func (c *Clause) Len() int {
 }
 
 // sorts the literals in the clause
-func (c *Clause) Sort(){
+func (c *Clause) Sort() {
 	sort.Slice(c.lits, func(i, j int) bool {
 		return c.lits[i] < c.lits[j]
 	})
@@ -102,23 +108,28 @@ func (l Lit) Negation() Lit {
 	return l ^ 1
 }
 
+// IntToVar converts a CNF variable to a Var.
+func IntToVar(i int32) Var {
+	return Var(i - 1)
+}
+
 // Lit returns the positive Lit associated to v.
 func (v Var) Lit() Lit {
 	return Lit(v * 2)
 }
 
-
 func (l Lit) Var() Var {
 	return Var(l / 2)
 }
 
 // CNF returns a DIMACS CNF representation of the clause.
 func (c *Clause) CNF() string {
-	res := ""
+	var buf []byte
 	for _, lit := range c.lits {
-		res += fmt.Sprintf("%d ", lit.Int())
+		buf = strconv.AppendInt(buf, int64(lit.Int()), 10)
+		buf = append(buf, ' ')
 	}
-	return fmt.Sprintf("%s0", res)
+	return string(append(buf, '0'))
 }
 
 //////
@@ -189,10 +200,11 @@ func (c *Clause) Simplify() (isSat bool) {
 	lits := make([]Lit, 0, len(c.lits))
 	i := 0
 	for i < len(c.lits) {
-		if i < len(c.lits)-1 && c.lits[i] == c.lits[i+1].Negation() {
+		lit := c.lits[i]
+		// lits are sorted, so a lit and its negation are next to each other once duplicates are skipped
+		if len(lits) != 0 && lits[len(lits)-1] == lit.Negation() {
 			return true
 		}
-		lit := c.lits[i]
 		lits = append(lits, lit)
 		i++
 		for i < len(c.lits) && c.lits[i] == lit {
@@ -0,0 +1,156 @@
+package Preprocessor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PARSING OF WEIGHTED (PARTIAL) MAXSAT FILES
+
+// softClause is a clause that may be falsified at the given cost.
+type softClause struct {
+	lits   []Lit
+	weight int
+}
+
+// ParseWCNF parses a WCNF file and returns the corresponding Problem.
+// Both the classic format (with a "p wcnf nbvars nbclauses [top]" header, where clauses
+// weighing at least top are hard) and the header-less format (where hard clauses start with "h")
+// are accepted.
+// Hard clauses become regular clauses. A soft clause C of weight w is relaxed into the hard
+// clause C | r, where r is a fresh var, and r is added to the cost function with weight w.
+// Soft unit clauses (l) don't need a relaxation var: -l is directly added to the cost function.
+// Like with ParseCNF, units and empty clauses are kept in pb.Clauses.
+func ParseWCNF(f io.Reader) (*Problem, error) {
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024*1024)
+	var (
+		pb     Problem
+		softs  []softClause
+		top    = -1 // -1 means every weighted clause is soft
+		header = false
+		lineNb = 0
+	)
+	for sc.Scan() {
+		lineNb++
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || fields[0][0] == 'c' { // Ignore comments & empty lines
+			continue
+		}
+		if fields[0] == "p" {
+			if header {
+				return nil, fmt.Errorf("line %d: duplicate header", lineNb)
+			}
+			header = true
+			var err error
+			if top, err = parseWCNFHeader(fields, &pb); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNb, err)
+			}
+			continue
+		}
+		hard := fields[0] == "h"
+		weight := 0
+		if !hard {
+			w, err := strconv.ParseInt(fields[0], 10, strconv.IntSize)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid weight %q", lineNb, fields[0])
+			}
+			if w <= 0 {
+				return nil, fmt.Errorf("line %d: weight %d is not strictly positive", lineNb, w)
+			}
+			weight = int(w)
+			hard = top != -1 && weight >= top
+		}
+		lits, err := parseWCNFLits(fields[1:], &pb, header)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNb, err)
+		}
+		if hard {
+			pb.addClause(lits)
+		} else {
+			softs = append(softs, softClause{lits: lits, weight: weight})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("could not read WCNF: %v", err)
+	}
+	pb.addSoftClauses(softs)
+	return &pb, nil
+}
+
+// parseWCNFHeader parses a "p wcnf nbvars nbclauses [top]" line and returns top, or -1 if it was not specified.
+func parseWCNFHeader(fields []string, pb *Problem) (top int, err error) {
+	if len(fields) < 4 || len(fields) > 5 || fields[1] != "wcnf" {
+		return 0, fmt.Errorf("invalid syntax %q in header", strings.Join(fields, " "))
+	}
+	if pb.NbVars, err = strconv.Atoi(fields[2]); err != nil || pb.NbVars < 0 {
+		return 0, fmt.Errorf("nbvars not a positive int : %q", fields[2])
+	}
+	nbClauses, err := strconv.Atoi(fields[3])
+	if err != nil || nbClauses < 0 {
+		return 0, fmt.Errorf("nbClauses not a positive int : %q", fields[3])
+	}
+	pb.Clauses = make([]*Clause, 0, nbClauses)
+	if len(fields) == 4 {
+		return -1, nil
+	}
+	top64, err := strconv.ParseInt(fields[4], 10, strconv.IntSize)
+	if err != nil || top64 <= 0 {
+		return 0, fmt.Errorf("top not a strictly positive int : %q", fields[4])
+	}
+	return int(top64), nil
+}
+
+// parseWCNFLits parses the lits of a clause, terminated by a 0.
+// If there was no header, NbVars grows to accomodate every var.
+func parseWCNFLits(fields []string, pb *Problem, header bool) ([]Lit, error) {
+	if len(fields) == 0 || fields[len(fields)-1] != "0" {
+		return nil, fmt.Errorf("clause does not end with 0")
+	}
+	lits := make([]Lit, 0, len(fields)-1)
+	for _, field := range fields[:len(fields)-1] {
+		val, err := strconv.ParseInt(field, 10, 32)
+		if err != nil || val == 0 {
+			return nil, fmt.Errorf("invalid literal %q", field)
+		}
+		v := int(val)
+		if v < 0 {
+			v = -v
+		}
+		if v > pb.NbVars {
+			if header {
+				return nil, fmt.Errorf("invalid literal %d for problem with %d vars only", val, pb.NbVars)
+			}
+			pb.NbVars = v
+		}
+		lits = append(lits, IntToLit(int32(val)))
+	}
+	return lits, nil
+}
+
+// addSoftClauses relaxes the given soft clauses and sets the cost function accordingly.
+// It also allocates the model, since new vars are created here.
+func (pb *Problem) addSoftClauses(softs []softClause) {
+	var (
+		minLits    []Lit
+		minWeights []int
+	)
+	for _, soft := range softs {
+		if len(soft.lits) == 1 {
+			minLits = append(minLits, soft.lits[0].Negation())
+		} else {
+			relax := Var(pb.NbVars)
+			pb.NbVars++
+			pb.Clauses = append(pb.Clauses, NewClause(append(soft.lits, relax.Lit())))
+			minLits = append(minLits, relax.Lit())
+		}
+		minWeights = append(minWeights, soft.weight)
+	}
+	pb.Model = make([]decLevel, pb.NbVars)
+	if len(softs) != 0 {
+		pb.SetCostFunc(minLits, minWeights)
+	}
+}
@@ -0,0 +1,190 @@
+package Preprocessor
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// STREAMING OUTPUT OF PROBLEMS
+// Formulas are written through a buffer, so that huge problems never have to be built as a single string.
+// Errors are sticky in a bufio.Writer, so they are only checked when the buffer is flushed.
+
+// formulaWriter is a buffered writer with helpers to write DIMACS-like lines.
+type formulaWriter struct {
+	*bufio.Writer
+	buf []byte // Scratch buffer used to format ints without allocating
+}
+
+func newFormulaWriter(w io.Writer) *formulaWriter {
+	return &formulaWriter{Writer: bufio.NewWriterSize(w, 64*1024)}
+}
+
+// int writes i in decimal.
+func (fw *formulaWriter) int(i int64) {
+	fw.buf = strconv.AppendInt(fw.buf[:0], i, 10)
+	fw.Write(fw.buf)
+}
+
+// header writes a "p <format> n1 n2 ..." line.
+func (fw *formulaWriter) header(format string, nbs ...int) {
+	fw.WriteString("p ")
+	fw.WriteString(format)
+	for _, n := range nbs {
+		fw.WriteByte(' ')
+		fw.int(int64(n))
+	}
+	fw.WriteByte('\n')
+}
+
+// lits writes the given lits followed by " 0\n", or just "0\n" if there are no lits.
+func (fw *formulaWriter) lits(lits []Lit) {
+	for _, lit := range lits {
+		fw.int(int64(lit.Int()))
+		fw.WriteByte(' ')
+	}
+	fw.WriteString("0\n")
+}
+
+// unit writes the unit clause lit.
+func (fw *formulaWriter) unit(lit Lit) {
+	fw.int(int64(lit.Int()))
+	fw.WriteString(" 0\n")
+}
+
+// xor writes x as an "x" line.
+func (fw *formulaWriter) xor(x *XorClause) {
+	fw.WriteString(x.CNF())
+	fw.WriteByte('\n')
+}
+
+// toString returns what write writes.
+func toString(write func(io.Writer) error) string {
+	var sb strings.Builder
+	write(&sb) // Writing to a strings.Builder never fails
+	return sb.String()
+}
+
+// WriteDIMACS writes a DIMACS CNF representation of the problem to w.
+// Names of vars, if any, are given as "c var <int> <name>" comments, and xor constraints are written as "x" lines.
+// An UNSAT problem is represented by a single empty clause.
+func (pb *Problem) WriteDIMACS(w io.Writer) error {
+	fw := newFormulaWriter(w)
+	for i, name := range pb.Names {
+		if name == "" {
+			continue
+		}
+		fw.WriteString("c var ")
+		fw.int(int64(Var(i).Lit().Int()))
+		fw.WriteByte(' ')
+		fw.WriteString(name)
+		fw.WriteByte('\n')
+	}
+	if pb.Status == Unsat {
+		fw.header("cnf", pb.NbVars, 1)
+		fw.lits(nil)
+		return fw.Flush()
+	}
+	fw.header("cnf", pb.NbVars, len(pb.Clauses)+len(pb.Units)+len(pb.Xors))
+	for _, unit := range pb.Units {
+		fw.unit(unit)
+	}
+	for _, clause := range pb.Clauses {
+		fw.lits(clause.lits)
+	}
+	for _, x := range pb.Xors {
+		fw.xor(x)
+	}
+	return fw.Flush()
+}
+
+// WriteQDIMACS writes a QDIMACS representation of the problem to w, i.e a DIMACS CNF representation
+// preceded by the quantifier prefix.
+// A false QBF is represented by a single empty clause.
+func (pb *Problem) WriteQDIMACS(w io.Writer) error {
+	fw := newFormulaWriter(w)
+	nbClauses := len(pb.Clauses) + len(pb.Units)
+	if pb.Status == Unsat {
+		nbClauses = 1
+	}
+	fw.header("cnf", pb.NbVars, nbClauses)
+	for _, block := range pb.Prefix {
+		if len(block.Vars) == 0 {
+			continue
+		}
+		if block.Universal {
+			fw.WriteByte('a')
+		} else {
+			fw.WriteByte('e')
+		}
+		for _, v := range block.Vars {
+			fw.WriteByte(' ')
+			fw.int(int64(v.Lit().Int()))
+		}
+		fw.WriteString(" 0\n")
+	}
+	if pb.Status == Unsat {
+		fw.lits(nil)
+		return fw.Flush()
+	}
+	for _, unit := range pb.Units {
+		fw.unit(unit)
+	}
+	for _, clause := range pb.Clauses {
+		fw.lits(clause.lits)
+	}
+	return fw.Flush()
+}
+
+// WriteWCNF writes a weighted DIMACS representation of the problem to w.
+// Clauses and units are written as hard clauses and each lit of the cost function
+// becomes a soft unit clause on its negation, so that the optimum is preserved.
+// An UNSAT problem is represented by a single empty hard clause.
+func (pb *Problem) WriteWCNF(w io.Writer) error {
+	fw := newFormulaWriter(w)
+	top := 1
+	for i := range pb.minLits {
+		top += pb.minWeight(i)
+	}
+	if pb.Status == Unsat {
+		fw.header("wcnf", pb.NbVars, 1, top)
+		fw.int(int64(top))
+		fw.WriteByte(' ')
+		fw.lits(nil)
+		return fw.Flush()
+	}
+	fw.header("wcnf", pb.NbVars, len(pb.Clauses)+len(pb.Units)+len(pb.minLits), top)
+	for _, unit := range pb.Units {
+		fw.int(int64(top))
+		fw.WriteByte(' ')
+		fw.unit(unit)
+	}
+	for _, clause := range pb.Clauses {
+		fw.int(int64(top))
+		fw.WriteByte(' ')
+		fw.lits(clause.lits)
+	}
+	for i, lit := range pb.minLits {
+		fw.int(int64(pb.minWeight(i)))
+		fw.WriteByte(' ')
+		fw.unit(lit.Negation())
+	}
+	return fw.Flush()
+}
+
+// WriteICNF writes an iCNF representation of the incremental problem to w.
+func (inc *Incremental) WriteICNF(w io.Writer) error {
+	fw := newFormulaWriter(w)
+	fw.WriteString("p inccnf\n")
+	for i, batch := range inc.Batches {
+		for _, c := range batch {
+			fw.lits(c.lits)
+		}
+		if i < len(inc.Cubes) {
+			fw.WriteString("a ")
+			fw.lits(inc.Cubes[i])
+		}
+	}
+	return fw.Flush()
+}
@@ -0,0 +1,20 @@
+package Preprocessor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteWCNFUnsat(t *testing.T) {
+	pb, err := ParseWCNF(strings.NewReader("p wcnf 2 4 10\n10 1 0\n10 -1 2 0\n10 -2 0\n3 1 2 0\n"))
+	if err != nil {
+		t.Fatalf("could not parse formula: %v", err)
+	}
+	pb.Preprocess()
+	if pb.Status != Unsat {
+		t.Fatalf("expected UNSAT, got %v", pb.Status)
+	}
+	if got, want := pb.WCNF(), "p wcnf 3 1 4\n4 0\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
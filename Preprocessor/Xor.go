@@ -0,0 +1,237 @@
+package Preprocessor
+
+import (
+	"sort"
+	"strconv"
+)
+
+// NATIVE XOR CONSTRAINTS, AS IN CRYPTOMINISAT'S "x" LINES
+
+// A XorClause states that the xor of its vars is equal to its parity.
+// The DIMACS line "x1 -2 3 0" is stored as the vars 1, 2, 3 with parity false,
+// since negating a lit flips the parity of the constraint.
+type XorClause struct {
+	vars   []Var // sorted, without duplicates
+	parity bool
+}
+
+// NewXorClause returns the xor constraint stating that the xor of lits is true.
+// Negated lits flip the parity of the constraint, and duplicate vars cancel each other.
+func NewXorClause(lits []Lit) *XorClause {
+	x := &XorClause{parity: true}
+	vars := make([]Var, 0, len(lits))
+	for _, lit := range lits {
+		if !lit.IsPositive() {
+			x.parity = !x.parity
+		}
+		vars = append(vars, lit.Var())
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i] < vars[j] })
+	for i := 0; i < len(vars); i++ {
+		if i+1 < len(vars) && vars[i] == vars[i+1] { // v xor v = 0
+			i++
+			continue
+		}
+		x.vars = append(x.vars, vars[i])
+	}
+	return x
+}
+
+// Len returns the nb of vars in the constraint.
+func (x *XorClause) Len() int {
+	return len(x.vars)
+}
+
+// CNF returns a representation of x as an "x" line in extended DIMACS.
+func (x *XorClause) CNF() string {
+	buf := []byte{'x'}
+	for i, v := range x.vars {
+		lit := v.Lit()
+		if i == 0 && !x.parity {
+			lit = lit.Negation()
+		}
+		if i != 0 {
+			buf = append(buf, ' ')
+		}
+		buf = strconv.AppendInt(buf, int64(lit.Int()), 10)
+	}
+	return string(append(buf, " 0"...))
+}
+
+// clauses returns the 2^(n-1) clauses equivalent to x: each clause forbids
+// one of the assignments of its vars that has the wrong parity.
+func (x *XorClause) clauses() []*Clause {
+	n := x.Len()
+	var res []*Clause
+	for a := 0; a < 1<<uint(n); a++ {
+		nbTrue := 0
+		for i := 0; i < n; i++ {
+			if a&(1<<uint(i)) != 0 {
+				nbTrue++
+			}
+		}
+		if (nbTrue%2 == 1) == x.parity { // Correct parity
+			continue
+		}
+		lits := make([]Lit, n)
+		for i, v := range x.vars {
+			if a&(1<<uint(i)) != 0 {
+				lits[i] = v.Lit().Negation()
+			} else {
+				lits[i] = v.Lit()
+			}
+		}
+		res = append(res, NewClause(lits))
+	}
+	return res
+}
+
+// ExpandXors replaces all xor constraints by equivalent clauses.
+// Xors longer than cutLen are first cut into xors of at most cutLen vars, linked by fresh vars,
+// so that the nb of generated clauses stays linear in the length of the constraint.
+func (pb *Problem) ExpandXors(cutLen int) {
+	if cutLen < 3 {
+		panic("cutting length must be at least 3")
+	}
+	for _, x := range pb.Xors {
+		vars := x.vars
+		for len(vars) > cutLen {
+			// v1 xor ... xor v(k-1) xor t = 0, i.e t = v1 xor ... xor v(k-1)
+			t := pb.newVar()
+			chunk := &XorClause{vars: append(append([]Var{}, vars[:cutLen-1]...), t), parity: false}
+			pb.Clauses = append(pb.Clauses, chunk.clauses()...)
+			vars = append([]Var{t}, vars[cutLen-1:]...)
+		}
+		pb.Clauses = append(pb.Clauses, (&XorClause{vars: vars, parity: x.parity}).clauses()...)
+	}
+	pb.Xors = nil
+}
+
+// simplifyXors removes assigned vars from xor constraints.
+// It returns true iff new units were found.
+func (pb *Problem) simplifyXors() (newUnits bool) {
+	j := 0
+	for _, x := range pb.Xors {
+		k := 0
+		for _, v := range x.vars {
+			switch pb.Model[v] {
+			case 0:
+				x.vars[k] = v
+				k++
+			case 1:
+				x.parity = !x.parity
+			}
+		}
+		x.vars = x.vars[:k]
+		switch k {
+		case 0:
+			if x.parity {
+				pb.Status = Unsat
+				return false
+			}
+		case 1:
+			lit := x.vars[0].Lit()
+			if !x.parity {
+				lit = lit.Negation()
+			}
+			pb.addUnit(lit)
+			if pb.Status == Unsat {
+				return false
+			}
+			newUnits = true
+		default:
+			pb.Xors[j] = x
+			j++
+		}
+	}
+	pb.Xors = pb.Xors[:j]
+	return newUnits
+}
+
+// gaussXors runs Gauss-Jordan elimination on the xor constraints, seen as a linear system over GF(2).
+// The constraints themselves are kept as is, but the units it implies are added to the problem,
+// and the problem is UNSAT if the system is inconsistent.
+// It returns true iff new units were found.
+func (pb *Problem) gaussXors() (newUnits bool) {
+	if len(pb.Xors) == 0 {
+		return false
+	}
+	cols := make(map[Var]int) // column of each var
+	var vars []Var            // var of each column
+	for _, x := range pb.Xors {
+		for _, v := range x.vars {
+			if _, ok := cols[v]; !ok {
+				cols[v] = len(vars)
+				vars = append(vars, v)
+			}
+		}
+	}
+	nbWords := (len(vars) + 63) / 64
+	rows := make([][]uint64, len(pb.Xors))
+	parities := make([]bool, len(pb.Xors))
+	for i, x := range pb.Xors {
+		rows[i] = make([]uint64, nbWords)
+		for _, v := range x.vars {
+			col := cols[v]
+			rows[i][col/64] |= 1 << uint(col%64)
+		}
+		parities[i] = x.parity
+	}
+	pivotRow := 0
+	for col := 0; col < len(vars) && pivotRow < len(rows); col++ {
+		word, bit := col/64, uint64(1)<<uint(col%64)
+		sel := -1
+		for i := pivotRow; i < len(rows); i++ {
+			if rows[i][word]&bit != 0 {
+				sel = i
+				break
+			}
+		}
+		if sel == -1 {
+			continue
+		}
+		rows[pivotRow], rows[sel] = rows[sel], rows[pivotRow]
+		parities[pivotRow], parities[sel] = parities[sel], parities[pivotRow]
+		for i := range rows {
+			if i != pivotRow && rows[i][word]&bit != 0 {
+				for w := range rows[i] {
+					rows[i][w] ^= rows[pivotRow][w]
+				}
+				parities[i] = parities[i] != parities[pivotRow]
+			}
+		}
+		pivotRow++
+	}
+	for i, row := range rows {
+		nbVars, col := 0, -1
+		for w, bits := range row {
+			for b := uint(0); b < 64 && bits != 0; b++ {
+				if bits&(1<<b) != 0 {
+					nbVars++
+					col = w*64 + int(b)
+					bits &^= 1 << b
+				}
+			}
+		}
+		switch {
+		case nbVars == 0 && parities[i]: // 0 = 1
+			pb.Status = Unsat
+			return false
+		case nbVars == 1:
+			lit := vars[col].Lit()
+			if !parities[i] {
+				lit = lit.Negation()
+			}
+			if pb.Model[lit.Var()] == 0 {
+				pb.addUnit(lit)
+				newUnits = true
+			} else if (pb.Model[lit.Var()] == 1) != lit.IsPositive() {
+				pb.Status = Unsat
+			}
+			if pb.Status == Unsat {
+				return false
+			}
+		}
+	}
+	return newUnits
+}
@@ -0,0 +1,558 @@
+package Preprocessor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// clauseLits returns the lits of the units and clauses of pb.
+func clauseLits(pb *Problem) [][]Lit {
+	var res [][]Lit
+	for _, lit := range pb.Units {
+		res = append(res, []Lit{lit})
+	}
+	for _, c := range pb.Clauses {
+		res = append(res, c.lits)
+	}
+	return res
+}
+
+// satisfies returns true iff the given values, indexed by var, satisfy all clauses.
+func satisfies(values []bool, clauses [][]Lit) bool {
+	for _, c := range clauses {
+		sat := false
+		for _, lit := range c {
+			if values[lit.Var()] == lit.IsPositive() {
+				sat = true
+				break
+			}
+		}
+		if !sat {
+			return false
+		}
+	}
+	return true
+}
+
+// forEachModel calls f on each model of clauses, by brute force, until f returns false.
+func forEachModel(nbVars int, clauses [][]Lit, f func(values []bool) bool) {
+	values := make([]bool, nbVars)
+	for m := 0; m < 1<<uint(nbVars); m++ {
+		for v := range values {
+			values[v] = m&(1<<uint(v)) != 0
+		}
+		if satisfies(values, clauses) && !f(values) {
+			return
+		}
+	}
+}
+
+// checkSimplify parses cnf, freezes the given vars, and simplifies the problem with the given options,
+// once for each proof format. It then checks that the simplified problem is SAT iff the original one is,
+// that each model of the simplified problem is extended to a model of the original one, and that
+// the proof is valid. It returns the simplified problem.
+func checkSimplify(t *testing.T, cnf string, frozen []int, opts *Options, simplify func(pb *Problem)) *Problem {
+	t.Helper()
+	orig, err := ParseCNF(strings.NewReader(cnf))
+	if err != nil {
+		t.Fatalf("could not parse formula: %v\n%s", err, cnf)
+	}
+	origClauses := clauseLits(orig)
+	origSat := false
+	forEachModel(orig.NbVars, origClauses, func([]bool) bool {
+		origSat = true
+		return false
+	})
+	var pb *Problem
+	for _, format := range []ProofFormat{DRAT, LRAT} {
+		pb, _ = ParseCNF(strings.NewReader(cnf))
+		for _, v := range frozen {
+			pb.Freeze(Var(v - 1))
+		}
+		pb.Options = opts
+		var proof bytes.Buffer
+		pb.SetProof(&proof, format)
+		simplify(pb)
+		if err := pb.FlushProof(); err != nil {
+			t.Fatalf("could not write proof: %v", err)
+		}
+		steps, err := ParseProof(&proof, format)
+		if err != nil {
+			t.Fatalf("format %v: could not parse proof: %v\n%s", format, err, cnf)
+		}
+		orig, _ := ParseCNF(strings.NewReader(cnf))
+		res, err := orig.CheckProof(steps, format)
+		if err != nil {
+			t.Fatalf("format %v: proof was rejected: %v\n%s", format, err, cnf)
+		}
+		if res.Refutation != (pb.Status == Unsat) {
+			t.Fatalf("format %v: status is %v, but refutation is %v\n%s", format, pb.Status, res.Refutation, cnf)
+		}
+	}
+	if pb.Status == Unsat {
+		if origSat {
+			t.Fatalf("SAT problem was simplified to UNSAT\n%s", cnf)
+		}
+		return pb
+	}
+	var stack bytes.Buffer
+	if err := pb.WriteStack(&stack); err != nil {
+		t.Fatalf("could not write stack: %v", err)
+	}
+	st, err := ParseStack(&stack)
+	if err != nil {
+		t.Fatalf("could not parse stack: %v", err)
+	}
+	simpSat := false
+	forEachModel(pb.NbVars, clauseLits(pb), func(values []bool) bool {
+		simpSat = true
+		model := make([]Lit, len(values))
+		for v, val := range values {
+			model[v] = Var(v).Lit()
+			if !val {
+				model[v] = model[v].Negation()
+			}
+		}
+		ext, err := st.Extend(model)
+		if err != nil {
+			t.Fatalf("could not extend model: %v", err)
+		}
+		extValues := make([]bool, orig.NbVars)
+		extInts := make([]int32, len(ext))
+		for i, lit := range ext {
+			extValues[lit.Var()] = lit.IsPositive()
+			extInts[i] = lit.Int()
+		}
+		if !satisfies(extValues, origClauses) {
+			t.Fatalf("extended model %v is not a model of the original problem\n%s\nsimplified:\n%s", extInts, cnf, pb.CNF())
+		}
+		return true
+	})
+	if simpSat != origSat {
+		t.Fatalf("original problem SAT: %v, simplified problem SAT: %v\n%s\nsimplified:\n%s", origSat, simpSat, cnf, pb.CNF())
+	}
+	return pb
+}
+
+// randomCNF returns a random formula, whose clauses of 1 to 4 lits are mostly binary.
+func randomCNF(r *rand.Rand, nbVars int) string {
+	var clauses []string
+	for i := r.Intn(4*nbVars) + 1; i > 0; i-- {
+		n := 1 + r.Intn(4)
+		if r.Intn(3) == 0 {
+			n = 2
+		}
+		clauses = append(clauses, randomClause(r, nbVars, n))
+	}
+	return fmt.Sprintf("p cnf %d %d\n%s", nbVars, len(clauses), strings.Join(clauses, ""))
+}
+
+// randomGates returns a random formula where each var but the first few ones is defined by
+// an AND, XOR or ITE gate of previous vars, followed by a few random clauses.
+func randomGates(r *rand.Rand, nbVars int) string {
+	var clauses []string
+	for v := 3 + r.Intn(3); v <= nbVars; v++ {
+		a, b, c := randomLit(r, v-1), randomLit(r, v-1), randomLit(r, v-1)
+		switch r.Intn(3) {
+		case 0: // v = a AND b
+			clauses = append(clauses, fmt.Sprintf("%d %d 0\n", -v, a), fmt.Sprintf("%d %d 0\n", -v, b),
+				fmt.Sprintf("%d %d %d 0\n", v, -a, -b))
+		case 1: // v = a XOR b
+			clauses = append(clauses, fmt.Sprintf("%d %d %d 0\n", -v, a, b), fmt.Sprintf("%d %d %d 0\n", -v, -a, -b),
+				fmt.Sprintf("%d %d %d 0\n", v, -a, b), fmt.Sprintf("%d %d %d 0\n", v, a, -b))
+		case 2: // v = IF c THEN a ELSE b
+			clauses = append(clauses, fmt.Sprintf("%d %d %d 0\n", -v, -c, a), fmt.Sprintf("%d %d %d 0\n", -v, c, b),
+				fmt.Sprintf("%d %d %d 0\n", v, -c, -a), fmt.Sprintf("%d %d %d 0\n", v, c, -b))
+		}
+	}
+	for i := 1 + r.Intn(2*nbVars); i > 0; i-- {
+		clauses = append(clauses, randomClause(r, nbVars, 1+r.Intn(3)))
+	}
+	return fmt.Sprintf("p cnf %d %d\n%s", nbVars, len(clauses), strings.Join(clauses, ""))
+}
+
+// randomLit returns a random lit of one of the first nbVars vars, in DIMACS format.
+func randomLit(r *rand.Rand, nbVars int) int {
+	lit := 1 + r.Intn(nbVars)
+	if r.Intn(2) == 0 {
+		return -lit
+	}
+	return lit
+}
+
+// randomClause returns a random clause of n lits, possibly duplicate or complementary ones, in DIMACS format.
+func randomClause(r *rand.Rand, nbVars, n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "%d ", randomLit(r, nbVars))
+	}
+	sb.WriteString("0\n")
+	return sb.String()
+}
+
+// TestPreprocessRandom preprocesses random small formulas, some of them with frozen vars, and checks the results.
+func TestPreprocessRandom(t *testing.T) {
+	nbTests := 1000
+	if testing.Short() {
+		nbTests = 50
+	}
+	r := rand.New(rand.NewSource(1))
+	var total Stats
+	for i := 0; i < nbTests; i++ {
+		nbVars := 3 + r.Intn(6)
+		cnf := randomCNF(r, nbVars)
+		if r.Intn(2) == 0 {
+			nbVars += 2
+			cnf = randomGates(r, nbVars)
+		}
+		var frozen []int
+		if r.Intn(2) == 0 {
+			for v := 1; v <= nbVars; v++ {
+				if r.Intn(3) == 0 {
+					frozen = append(frozen, v)
+				}
+			}
+		}
+		opts := &Options{Grow: r.Intn(3), MaxResolventLen: 20, CoverEffort: 1000, ProbeLimit: 1000}
+		pb := checkSimplify(t, cnf, frozen, opts, (*Problem).Preprocess)
+		isFrozen := make([]bool, nbVars)
+		for _, v := range frozen {
+			isFrozen[v-1] = true
+		}
+		for _, e := range pb.stack { // Extending a model must not change the value of a frozen var
+			if isFrozen[e.Witness.Var()] {
+				t.Fatalf("frozen var %d is the witness of a removed clause\n%s", e.Witness.Var().Lit().Int(), cnf)
+			}
+		}
+		total.EliminatedVars += pb.Stats.EliminatedVars
+		total.Substituted += pb.Stats.Substituted
+	}
+	if total.EliminatedVars == 0 || total.Substituted == 0 {
+		t.Errorf("random formulas were barely simplified: %d eliminated vars, %d substituted vars",
+			total.EliminatedVars, total.Substituted)
+	}
+}
+
+// TestEliminateVar checks that a var is eliminated when there are no more resolvents than clauses containing it.
+func TestEliminateVar(t *testing.T) {
+	// The 4 clauses containing 1 are replaced by the resolvents (2 4), (2 5), (3 4) and (3 5),
+	// which subsume (2 3 4 5). The other vars are frozen, so none of the clauses is blocked.
+	const cnf = "p cnf 5 5\n1 2 0\n1 3 0\n-1 4 0\n-1 5 0\n2 3 4 5 0\n"
+	pb := checkSimplify(t, cnf, []int{2, 3, 4, 5}, nil, func(pb *Problem) { pb.eliminateVars() })
+	if pb.Stats.EliminatedVars != 1 {
+		t.Errorf("expected 1 eliminated var, got %d", pb.Stats.EliminatedVars)
+	}
+	if got, want := len(pb.Clauses), 4; got != want {
+		t.Errorf("expected %d clauses, got %d:\n%s", want, got, pb.CNF())
+	}
+}
+
+// TestEliminateGate checks that vars defined by gates are eliminated without resolving the gate clauses together.
+func TestEliminateGate(t *testing.T) {
+	tests := []struct {
+		name      string
+		cnf       string
+		frozen    []int
+		gates     Gates
+		nbClauses int
+	}{
+		{ // Only the resolvents (-2 -3 5), (2 4) and (3 4) are added, instead of 4 without the gate
+			name:      "1 = 2 AND 3",
+			cnf:       "p cnf 5 5\n-1 2 0\n-1 3 0\n1 -2 -3 0\n1 4 0\n-1 5 0\n",
+			frozen:    []int{2, 3, 4, 5},
+			gates:     Gates{And: 1},
+			nbClauses: 3,
+		},
+		{
+			name:      "1 = 2 XOR 3",
+			cnf:       "p cnf 5 6\n-1 2 3 0\n-1 -2 -3 0\n1 -2 3 0\n1 2 -3 0\n1 4 0\n-1 5 0\n",
+			frozen:    []int{2, 3, 4, 5},
+			gates:     Gates{Xor: 1},
+			nbClauses: 4,
+		},
+		{
+			name:      "1 = IF 2 THEN 3 ELSE 4",
+			cnf:       "p cnf 6 6\n-1 -2 3 0\n-1 2 4 0\n1 -2 -3 0\n1 2 -4 0\n1 5 0\n-1 6 0\n",
+			frozen:    []int{2, 3, 4, 5, 6},
+			gates:     Gates{ITE: 1},
+			nbClauses: 4,
+		},
+	}
+	for _, test := range tests {
+		pb := checkSimplify(t, test.cnf, test.frozen, nil, func(pb *Problem) { pb.eliminateVars() })
+		if pb.Stats.EliminatedVars != 1 || pb.Stats.Gates != test.gates {
+			t.Errorf("%s: expected 1 var eliminated with gates %+v, got %d eliminated vars, gates %+v",
+				test.name, test.gates, pb.Stats.EliminatedVars, pb.Stats.Gates)
+		}
+		if len(pb.Clauses) != test.nbClauses {
+			t.Errorf("%s: expected %d clauses, got %d:\n%s", test.name, test.nbClauses, len(pb.Clauses), pb.CNF())
+		}
+	}
+}
+
+// TestEliminateBlocked checks that a blocked clause is removed, and that models are extended with its blocking lit.
+func TestEliminateBlocked(t *testing.T) {
+	// (1 2) is blocked on 1, since its only resolvent on 1, with (-1 -2), is a tautology.
+	// The model 1 = 2 = false of the other clauses must be extended by making 1 true.
+	const cnf = "p cnf 3 3\n1 2 0\n1 3 0\n-1 -2 0\n"
+	pb := checkSimplify(t, cnf, []int{2, 3}, nil, func(pb *Problem) { pb.eliminateBlocked() })
+	if pb.Stats.Blocked != 1 {
+		t.Errorf("expected 1 blocked clause, got %d", pb.Stats.Blocked)
+	}
+	if len(pb.stack) != 1 || pb.stack[0].Witness != IntToLit(1) {
+		t.Errorf("expected (1 2) to be pushed with witness 1, got stack %v", pb.stack)
+	}
+}
+
+// TestEliminateCovered checks that a clause that becomes blocked once extended with covered lits is removed.
+func TestEliminateCovered(t *testing.T) {
+	// (1 2) is not blocked, but its resolvents on 1 all contain 3, so it is extended to (1 2 3),
+	// which is blocked on 3.
+	const cnf = "p cnf 5 3\n1 2 0\n-1 3 4 0\n-1 3 5 0\n"
+	pb := checkSimplify(t, cnf, []int{2, 4, 5}, nil, func(pb *Problem) { pb.eliminateCovered() })
+	if pb.Stats.Covered == 0 {
+		t.Errorf("no covered clause was removed")
+	}
+	want := []StackEntry{
+		{Witness: IntToLit(1), Clause: []Lit{IntToLit(1), IntToLit(2)}},
+		{Witness: IntToLit(3), Clause: []Lit{IntToLit(1), IntToLit(2), IntToLit(3)}},
+	}
+	if len(pb.stack) < len(want) || !reflect.DeepEqual(pb.stack[:len(want)], want) {
+		t.Errorf("expected stack to start with %v, got %v", want, pb.stack)
+	}
+}
+
+// TestEliminateAsymmetric checks that a clause implied by others through asymmetric lits is removed.
+func TestEliminateAsymmetric(t *testing.T) {
+	// (1 4) adds -4 to (1 2 3), which then contains all the lits of (-4 2).
+	const cnf = "p cnf 4 3\n1 2 3 0\n1 4 0\n-4 2 0\n"
+	pb := checkSimplify(t, cnf, []int{1, 2, 3, 4}, nil, func(pb *Problem) { pb.eliminateCovered() })
+	if pb.Stats.Covered != 1 || len(pb.Clauses) != 2 || pb.Clauses[0].Len() != 2 {
+		t.Errorf("expected (1 2 3) to be removed, got:\n%s", pb.CNF())
+	}
+	if len(pb.stack) != 0 { // An implied clause needs no reconstruction
+		t.Errorf("expected empty stack, got %v", pb.stack)
+	}
+}
+
+// TestSubstituteEquivalences checks that equivalent lits are replaced by their representative,
+// which is frozen if one of them is.
+func TestSubstituteEquivalences(t *testing.T) {
+	// 1, 2 and 3 are equivalent
+	const cnf = "p cnf 5 6\n-1 2 0\n-2 3 0\n-3 1 0\n1 4 5 0\n-2 -4 0\n-1 -5 0\n"
+	tests := []struct {
+		name        string
+		frozen      []int
+		substituted int
+		want        string
+	}{
+		{
+			name:        "no frozen var",
+			substituted: 2,
+			want:        "p cnf 5 3\n1 4 5 0\n-1 -4 0\n-1 -5 0\n",
+		},
+		{
+			name:        "frozen representative",
+			frozen:      []int{3},
+			substituted: 2,
+			want:        "p cnf 5 3\n3 4 5 0\n-3 -4 0\n-3 -5 0\n",
+		},
+		{ // 3 is not substituted either, so the equivalence between 2 and 3 is kept
+			name:        "two frozen vars",
+			frozen:      []int{2, 3},
+			substituted: 1,
+			want:        "p cnf 5 5\n-2 3 0\n2 -3 0\n2 4 5 0\n-2 -4 0\n-2 -5 0\n",
+		},
+	}
+	for _, test := range tests {
+		pb := checkSimplify(t, cnf, test.frozen, nil, func(pb *Problem) { pb.substituteEquivalences() })
+		if pb.Stats.Substituted != test.substituted {
+			t.Errorf("%s: expected %d substituted vars, got %d", test.name, test.substituted, pb.Stats.Substituted)
+		}
+		if got := pb.CNF(); got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+// TestProbeFailedLits checks that failed lits become units, and that equivalences are lifted from probes.
+func TestProbeFailedLits(t *testing.T) {
+	// 1 implies 2, 3, then 4, 5, and (-2 -5) is falsified, so -1 is a unit.
+	// 6 implies 8 and 7, and -6 implies 9 and -7, so 6 and 7 are equivalent,
+	// although they are not in an SCC of the binary implication graph. Once 7 is replaced by 6,
+	// the two clauses containing 7 are tautologies.
+	const cnf = "p cnf 9 10\n-1 2 0\n-1 3 0\n-2 -3 4 0\n-4 5 0\n-2 -5 0\n2 3 4 5 0\n-6 8 0\n-6 -8 7 0\n6 9 0\n6 -9 -7 0\n"
+	pb := checkSimplify(t, cnf, nil, nil, (*Problem).probeFailedLits)
+	if pb.Stats.FailedLits != 1 || pb.Stats.LiftedEquivs != 1 || pb.Stats.Substituted != 1 {
+		t.Errorf("expected 1 failed lit, 1 lifted equivalence and 1 substituted var, got %d, %d and %d",
+			pb.Stats.FailedLits, pb.Stats.LiftedEquivs, pb.Stats.Substituted)
+	}
+	want := "p cnf 9 7\n-1 0\n-2 -3 4 0\n-4 5 0\n-2 -5 0\n2 3 4 5 0\n-6 8 0\n6 9 0\n"
+	if got := pb.CNF(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+// TestSubsumeAndStrengthen checks that subsumed clauses are removed, that self-subsumed clauses are strengthened,
+// and that the units found by strengthening are propagated before the next round.
+func TestSubsumeAndStrengthen(t *testing.T) {
+	tests := []struct {
+		name         string
+		cnf          string
+		subsumed     int
+		strengthened int
+		want         string
+	}{
+		{ // (1 2) subsumes (1 2 3) and strengthens (-1 2 4) into (2 4), which then subsumes (2 3 4)
+			name:         "subsumption and strengthening",
+			cnf:          "p cnf 4 4\n1 2 0\n1 2 3 0\n-1 2 4 0\n2 3 4 0\n",
+			subsumed:     2,
+			strengthened: 1,
+			want:         "p cnf 4 2\n1 2 0\n2 4 0\n",
+		},
+		{ // (1 2) and (1 -2) resolve into the unit 1, which satisfies them and removes -1 from (-1 2 3)
+			name:         "unit found by strengthening",
+			cnf:          "p cnf 3 3\n1 2 0\n1 -2 0\n-1 2 3 0\n",
+			strengthened: 1,
+			want:         "p cnf 3 2\n1 0\n2 3 0\n",
+		},
+	}
+	for _, test := range tests {
+		pb := checkSimplify(t, test.cnf, nil, nil, (*Problem).subsumeAndStrengthen)
+		if pb.Stats.Subsumed != test.subsumed || pb.Stats.Strengthened != test.strengthened {
+			t.Errorf("%s: expected %d subsumed clauses and %d strengthened ones, got %d and %d",
+				test.name, test.subsumed, test.strengthened, pb.Stats.Subsumed, pb.Stats.Strengthened)
+		}
+		if got := pb.CNF(); got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+// subsumesLits returns true iff all the lits of c are in d, and, if self is true,
+// iff all the lits of c but one are in d and d contains the negation of the last one instead.
+func subsumesLits(c []Lit, d map[Lit]bool, self bool) bool {
+	nbNeg := 0
+	for _, lit := range c {
+		if d[lit] {
+			continue
+		}
+		if !self || !d[lit.Negation()] {
+			return false
+		}
+		nbNeg++
+	}
+	return nbNeg == 0 || (self && nbNeg == 1)
+}
+
+// forEachSubsumption calls f on each pair of distinct clauses (c, d) of pb such that c subsumes
+// or self-subsumes d, as found by comparing all their lits.
+func forEachSubsumption(pb *Problem, f func(c, d *Clause)) {
+	sets := make([]map[Lit]bool, len(pb.Clauses))
+	for i, c := range pb.Clauses {
+		sets[i] = make(map[Lit]bool, c.Len())
+		for _, lit := range c.lits {
+			sets[i][lit] = true
+		}
+	}
+	for i, c := range pb.Clauses {
+		for j, d := range pb.Clauses {
+			if i != j && c.Len() <= d.Len() && subsumesLits(c.lits, sets[j], true) {
+				f(c, d)
+			}
+		}
+	}
+}
+
+// TestSignature checks that signatures never discard a pair of clauses where one subsumes the other,
+// and that clauses with the same signature are still compared lit by lit.
+func TestSignature(t *testing.T) {
+	pb, err := ParseCNF(strings.NewReader("p cnf 66 2\n1 2 0\n2 3 65 0\n"))
+	if err != nil {
+		t.Fatalf("could not parse formula: %v", err)
+	}
+	// Vars 1 and 65 share a bit, so the signature of (1 2) is included in the one of (2 3 65)
+	c, d := pb.Clauses[0], pb.Clauses[1]
+	if signature(c.lits)&^signature(d.lits) != 0 {
+		t.Fatalf("expected signature of %v to be included in signature of %v", c.lits, d.lits)
+	}
+	pb.subsumeAndStrengthen()
+	if got, want := pb.CNF(), "p cnf 66 2\n1 2 0\n2 3 65 0\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	for _, name := range []string{"sudoku.cnf", "timetable4.cnf", "timetable5.cnf"} {
+		pb := subsumableTestFile(t, name)
+		nb := 0
+		forEachSubsumption(pb, func(c, d *Clause) {
+			nb++
+			if signature(c.lits)&^signature(d.lits) != 0 {
+				t.Errorf("%s: signature of %v is not included in signature of %v", name, c.lits, d.lits)
+			}
+		})
+		if nb == 0 {
+			t.Errorf("%s: no clause subsumes another one", name)
+		}
+	}
+}
+
+// TestSubsumptionFixpoint checks that, once subsumeAndStrengthen is run on the bundled instances,
+// no clause subsumes or self-subsumes another one.
+func TestSubsumptionFixpoint(t *testing.T) {
+	for _, name := range []string{"sudoku.cnf", "timetable4.cnf", "timetable5.cnf"} {
+		pb := subsumableTestFile(t, name)
+		pb.subsumeAndStrengthen()
+		if pb.Status != Undetermined {
+			t.Errorf("%s: expected status %v, got %v", name, Undetermined, pb.Status)
+			continue
+		}
+		if pb.Stats.Subsumed == 0 || pb.Stats.Strengthened == 0 {
+			t.Errorf("%s: expected subsumed and strengthened clauses, got %d and %d", name, pb.Stats.Subsumed, pb.Stats.Strengthened)
+		}
+		nb := 0
+		forEachSubsumption(pb, func(c, d *Clause) {
+			if nb++; nb <= 3 {
+				t.Errorf("%s: %v still subsumes or self-subsumes %v", name, c.lits, d.lits)
+			}
+		})
+	}
+}
+
+// subsumableTestFile parses one of the bundled CNF files and propagates its units.
+// Since the bundled files contain no subsumed clauses, every 5th clause c is then copied twice
+// with a fresh var, so that the problem stays SAT: once as is, so that c subsumes the copy,
+// and once with its first lit negated, so that c self-subsumes the copy.
+func subsumableTestFile(t *testing.T, name string) *Problem {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("could not open %s: %v", name, err)
+	}
+	defer f.Close()
+	pb, err := ParseCNF(f)
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", name, err)
+	}
+	pb.Simplify2()
+	n := len(pb.Clauses)
+	for i := 0; i < n; i += 5 {
+		c := pb.Clauses[i]
+		weakened := append(append([]Lit(nil), c.lits...), pb.newVar().Lit())
+		pb.addClause(weakened)
+		selfSubsumed := append([]Lit(nil), weakened...)
+		selfSubsumed[0] = selfSubsumed[0].Negation()
+		pb.addClause(selfSubsumed)
+	}
+	return pb
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"Preprocessor"
+	"preprocess"
+)
+
+// BATCH MODE: ALL THE FORMULAS OF A DIRECTORY, OR MATCHING A GLOB, ARE PREPROCESSED BY A POOL OF WORKERS
+
+// batchOptions are the options that apply to each formula of a batch.
+type batchOptions struct {
+	encoding string
+	mode     Preprocessor.ParseMode
+	xorCNF   bool
+	xorCut   int
+	cardCNF  bool
+	compact  bool
+	compress string // If not empty, compression of the simplified formulas, else they are compressed like their input
+	outDir   string // If not empty, root of the tree where simplified formulas are written, else they are written next to their input
+	jobs     int
+	pre      *Preprocessor.Options // Settings of the preprocessing. Only the elimination bounds apply to OPB and KNF formulas.
+}
+
+// A batchResult is the outcome of the preprocessing of a formula of a batch.
+type batchResult struct {
+	File          string  `json:"file"`
+	Output        string  `json:"output,omitempty"`
+	Status        string  `json:"status,omitempty"`
+	VarsBefore    int     `json:"vars_before"`
+	VarsAfter     int     `json:"vars_after"`
+	ClausesBefore int     `json:"clauses_before"`
+	ClausesAfter  int     `json:"clauses_after"`
+	LitsBefore    int     `json:"lits_before"`
+	LitsAfter     int     `json:"lits_after"`
+	Seconds       float64 `json:"seconds"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// isBatch returns true iff arg is a directory or a glob, rather than a single formula.
+func isBatch(arg string) bool {
+	if strings.ContainsAny(arg, "*?[") {
+		return true
+	}
+	info, err := os.Stat(arg)
+	return err == nil && info.IsDir()
+}
+
+// batchFormat returns true iff path is a formula that can be preprocessed in a batch.
+// Formulas simplified by a previous batch are ignored.
+func batchFormat(path string) bool {
+	name := Preprocessor.TrimCompressionExt(path)
+	if strings.Contains(filepath.Base(name), ".simplified.") {
+		return false
+	}
+	switch filepath.Ext(name) {
+	case ".cnf", ".qdimacs", ".wcnf", ".bf", ".opb", ".knf", ".icnf":
+		return true
+	default:
+		return false
+	}
+}
+
+// batchFiles returns the formulas in the directory, or matching the glob, arg, sorted by path,
+// and the directory that is mirrored in the output tree. Files under outDir are ignored.
+func batchFiles(arg, outDir string) (files []string, base string, err error) {
+	ignored := func(path string) bool {
+		if outDir == "" {
+			return false
+		}
+		rel, err := filepath.Rel(outDir, path)
+		return err == nil && !strings.HasPrefix(rel, "..")
+	}
+	if info, err := os.Stat(arg); err == nil && info.IsDir() {
+		err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && ignored(path) {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && batchFormat(path) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		return files, arg, err
+	}
+	matches, err := filepath.Glob(arg)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() && batchFormat(path) && !ignored(path) {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	base = filepath.Dir(arg)
+	if i := strings.IndexAny(arg, "*?["); i != -1 { // The directory containing the first component with a wildcard
+		base = filepath.Dir(arg[:i] + "x")
+	}
+	return files, base, nil
+}
+
+// batchOutput returns the path where the simplified version of the formula at path is written.
+func batchOutput(path, base string, opts *batchOptions) string {
+	compExt := Preprocessor.CompressionFromPath(path).Ext()
+	name := strings.TrimSuffix(path, compExt)
+	if opts.compress != "" {
+		comp, _ := Preprocessor.ParseCompression(opts.compress) // Already checked
+		compExt = comp.Ext()
+	}
+	ext := filepath.Ext(name)
+	name = strings.TrimSuffix(name, ext)
+	if ext == ".knf" && opts.cardCNF {
+		ext = ".cnf"
+	}
+	if opts.outDir == "" {
+		return name + ".simplified" + ext + compExt
+	}
+	rel, err := filepath.Rel(base, name)
+	if err != nil {
+		rel = filepath.Base(name)
+	}
+	return filepath.Join(opts.outDir, rel+ext+compExt)
+}
+
+// setSizes sets the sizes of the formula before and after preprocessing.
+func (res *batchResult) setSizes(before, after Preprocessor.Size) {
+	res.VarsBefore, res.ClausesBefore, res.LitsBefore = before.Vars, before.Clauses, before.Lits
+	res.VarsAfter, res.ClausesAfter, res.LitsAfter = after.Vars, after.Clauses, after.Lits
+}
+
+// pbSize returns the size of a problem of the preprocess package.
+func pbSize(pb *preprocess.Problem) Preprocessor.Size {
+	s := Preprocessor.Size{Clauses: len(pb.Clauses) + len(pb.Units), Lits: len(pb.Units)}
+	used := make(map[preprocess.Var]bool)
+	for _, c := range pb.Clauses {
+		s.Lits += c.Len()
+		for i := 0; i < c.Len(); i++ {
+			used[c.Get(i).Var()] = true
+		}
+	}
+	s.Vars = len(used)
+	return s
+}
+
+// pbStatus returns the status of a problem of the preprocess package, so that all formulas
+// of a batch are summarized with the same statuses.
+func pbStatus(s preprocess.Status) Preprocessor.Status {
+	switch s {
+	case preprocess.Sat:
+		return Preprocessor.Sat
+	case preprocess.Unsat:
+		return Preprocessor.Unsat
+	default:
+		return Preprocessor.Undetermined
+	}
+}
+
+// icnfSize returns the size of an incremental problem.
+func icnfSize(inc *Preprocessor.Incremental) Preprocessor.Size {
+	var s Preprocessor.Size
+	used := make(map[Preprocessor.Var]bool)
+	for _, batch := range inc.Batches {
+		for _, c := range batch {
+			s.Clauses++
+			s.Lits += c.Len()
+			for i := 0; i < c.Len(); i++ {
+				used[c.Get(i).Var()] = true
+			}
+		}
+	}
+	s.Vars = len(used)
+	return s
+}
+
+// preprocessFile preprocesses the formula at path and writes the simplified formula to outPath.
+// Panics are recovered and reported as errors, so that a single formula can't stop the whole batch.
+func preprocessFile(path, outPath string, opts *batchOptions) (res batchResult) {
+	res.File = path
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			res.Error = fmt.Sprintf("panic: %v", r)
+		}
+		if res.Error != "" {
+			res.Output = ""
+		}
+		res.Seconds = time.Since(start).Seconds()
+	}()
+	var write func(io.Writer) error
+	switch ext := filepath.Ext(Preprocessor.TrimCompressionExt(path)); ext {
+	case ".cnf", ".qdimacs", ".wcnf", ".bf":
+		var pb *Preprocessor.Problem
+		var err error
+		if ext == ".bf" {
+			pb, err = parseBF(path, opts.encoding)
+		} else {
+			pb, err = parse(path, opts.mode)
+		}
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		pb.Options = opts.pre
+		pb.Preprocess()
+		switch {
+		case pb.QBF():
+			write = pb.WriteQDIMACS
+		case ext == ".wcnf":
+			write = pb.WriteWCNF
+		default:
+			if opts.xorCNF {
+				pb.ExpandXors(opts.xorCut)
+			}
+			write = pb.WriteDIMACS
+		}
+		res.Status = pb.Status.String()
+		res.setSizes(pb.Stats.Before, pb.Stats.After)
+		write = compacted(pb, write, opts.compact, "")
+	case ".opb", ".knf":
+		var pb *preprocess.Problem
+		var err error
+		if ext == ".opb" {
+			pb, err = parseOPB(path)
+		} else {
+			pb, err = parseKNF(path)
+		}
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		before := pbSize(pb)
+		pb.Options = &preprocess.Options{Grow: opts.pre.Grow, MaxResolventLen: opts.pre.MaxResolventLen}
+		pb.Preprocess()
+		switch {
+		case ext == ".opb":
+			write = pb.WriteOPB
+		case opts.cardCNF:
+			pb.EncodeCards()
+			write = pb.WriteDIMACS
+		default:
+			write = pb.WriteKNF
+		}
+		res.Status = pbStatus(pb.Status).String()
+		res.setSizes(before, pbSize(pb))
+	case ".icnf":
+		inc, err := parseICNF(path)
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		before := icnfSize(inc)
+		inc.Options = opts.pre
+		inc.Preprocess()
+		write = inc.WriteICNF
+		res.Status = inc.Status.String()
+		res.setSizes(before, icnfSize(inc))
+	}
+	res.Output = outPath
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if err := writeFile(outPath, write); err != nil {
+		res.Error = fmt.Sprintf("could not write %q: %v", outPath, err)
+	}
+	return res
+}
+
+// runBatch preprocesses all the formulas in the directory, or matching the glob, arg,
+// and writes a summary to summaryPath, as JSON if its extension is .json and as CSV otherwise,
+// or as CSV on stdout if summaryPath is empty.
+func runBatch(arg string, opts *batchOptions, summaryPath string) error {
+	files, base, err := batchFiles(arg, opts.outDir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no formula found in %q", arg)
+	}
+	log.SetOutput(ioutil.Discard) // Logs of concurrent runs would be interleaved
+	results := make([]batchResult, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j] = preprocessFile(files[j], batchOutput(files[j], base, opts), opts)
+			}
+		}()
+	}
+	for j := range files {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+	write := func(w io.Writer) error { return writeCSVSummary(w, results) }
+	if strings.HasSuffix(summaryPath, ".json") {
+		write = func(w io.Writer) error { return writeJSONSummary(w, results) }
+	}
+	if summaryPath == "" {
+		err = write(os.Stdout)
+	} else {
+		err = writeFile(summaryPath, write)
+	}
+	if err != nil {
+		return fmt.Errorf("could not write summary: %v", err)
+	}
+	nbErrors := 0
+	for _, res := range results {
+		if res.Error != "" {
+			nbErrors++
+		}
+	}
+	if nbErrors != 0 {
+		return fmt.Errorf("%d/%d formulas could not be preprocessed", nbErrors, len(files))
+	}
+	return nil
+}
+
+// reduction returns the relative reduction from before to after, as a percentage.
+func reduction(before, after int) string {
+	if before == 0 {
+		return "0.0"
+	}
+	return strconv.FormatFloat(100*float64(before-after)/float64(before), 'f', 1, 64)
+}
+
+// writeCSVSummary writes one line per formula, with a header line.
+func writeCSVSummary(w io.Writer, results []batchResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"file", "output", "status", "vars_before", "vars_after", "clauses_before", "clauses_after",
+		"lits_before", "lits_after", "clause_reduction_pct", "seconds", "error"})
+	for _, res := range results {
+		cw.Write([]string{
+			res.File, res.Output, res.Status,
+			strconv.Itoa(res.VarsBefore), strconv.Itoa(res.VarsAfter),
+			strconv.Itoa(res.ClausesBefore), strconv.Itoa(res.ClausesAfter),
+			strconv.Itoa(res.LitsBefore), strconv.Itoa(res.LitsAfter),
+			reduction(res.ClausesBefore, res.ClausesAfter),
+			strconv.FormatFloat(res.Seconds, 'f', 3, 64),
+			res.Error,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSONSummary writes the results as an indented JSON array.
+func writeJSONSummary(w io.Writer, results []batchResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
@@ -3,59 +3,657 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
 	"strings"
 
 	"Preprocessor"
+	"preprocess"
 )
 
 func main() {
 	var (
-		help    bool
+		help     bool
+		encoding string
+		compress string
+		lenient  bool
+		xorCNF   bool
+		xorCut   int
+		cardCNF  bool
+		outPath  string
+		compact  bool
+		mapPath  string
+		stack    string
+		proof    string
+		proofFmt string
+		corePath string
+		trimPath string
+		statPath string
+		jobs     int
+		outDir   string
+		summary  string
+		grow     int
+		maxRes   int
+		effort   int
+		probe    int
 	)
 	flag.BoolVar(&help, "help", false, "displays help")
+	flag.StringVar(&encoding, "encoding", "tseitin", "CNF encoding of .bf formulas: tseitin or pg (Plaisted-Greenbaum)")
+	flag.StringVar(&compress, "compress", "", "only write the simplified formula on stdout, compressed with gzip, bzip2, xz or lzma (bzip2 needs the bzip2 command, xz and lzma the xz command)")
+	flag.BoolVar(&lenient, "lenient", false, "accept malformed CNF files when possible, reporting problems as warnings")
+	flag.BoolVar(&xorCNF, "xor-cnf", false, "expand xor constraints into clauses instead of writing them as x lines")
+	flag.IntVar(&xorCut, "xor-cut", 4, "with -xor-cnf, length at which xor constraints are cut before being expanded (at least 3)")
+	flag.BoolVar(&cardCNF, "card-cnf", false, "encode cardinality constraints of .knf files into clauses")
+	flag.StringVar(&outPath, "o", "", "write the simplified formula to this file instead of stdout, compressed according to its extension unless -compress is given (.bz2 needs the bzip2 command, .xz and .lzma the xz command)")
+	flag.BoolVar(&compact, "compact", false, "renumber the vars of the simplified CNF, QDIMACS, WCNF or BF formula densely")
+	flag.StringVar(&mapPath, "map", "", "with -compact, write the var map to this file instead of embedding it as comments in the simplified formula")
+	flag.StringVar(&stack, "stack", "", "write the reconstruction stack of the CNF, QDIMACS, WCNF or BF formula to this file, for the extend command")
+	flag.StringVar(&proof, "proof", "", "write a proof of the simplification of the .cnf formula to this file")
+	flag.StringVar(&proofFmt, "proof-format", "drat", "with -proof or check-proof, format of the proof: drat, binary-drat or lrat")
+	flag.StringVar(&statPath, "stats-json", "", "write statistics about the preprocessing of the CNF, QDIMACS, WCNF or BF formula to this file, as JSON")
+	flag.IntVar(&grow, "grow", Preprocessor.DefaultOptions.Grow, "nb of clauses variable elimination can add to the formula")
+	flag.IntVar(&maxRes, "max-resolvent", Preprocessor.DefaultOptions.MaxResolventLen, "vars are not eliminated if it yields a longer resolvent (0 for no limit)")
+	flag.IntVar(&effort, "cover-effort", Preprocessor.DefaultOptions.CoverEffort, "nb of clause visits of covered clause elimination (0 to disable it)")
+	flag.IntVar(&probe, "probe-limit", Preprocessor.DefaultOptions.ProbeLimit, "nb of propagations of each round of failed literal probing (0 to disable it)")
+	flag.IntVar(&jobs, "jobs", runtime.NumCPU(), "in batch mode, nb of formulas preprocessed in parallel")
+	flag.StringVar(&outDir, "out-dir", "", "in batch mode, write the simplified formulas in this directory, mirroring the input tree, instead of next to their input")
+	flag.StringVar(&summary, "summary", "", "in batch mode, write the summary to this file instead of stdout, as JSON if it ends with .json and as CSV otherwise")
+	flag.StringVar(&corePath, "core", "", "with check-proof, write the UNSAT core to this file")
+	flag.StringVar(&trimPath, "trimmed", "", "with check-proof, write the trimmed proof, to be checked against the core, to this file")
 	flag.Parse()
-	if !help && len(flag.Args()) != 1 {
+	cmd := "" // uncompact or extend, when the model of a simplified formula is converted, or check-proof
+	if len(flag.Args()) == 3 && (flag.Arg(0) == "uncompact" || flag.Arg(0) == "extend" || flag.Arg(0) == "check-proof") {
+		cmd = flag.Arg(0)
+	}
+	if !help && len(flag.Args()) != 1 && cmd == "" {
 		fmt.Printf("This is GoPreProcessor. Functions taken from Gophersat. Modifications/additions by Michael Behr.\n")
-		fmt.Fprintf(os.Stderr, "Syntax : %s [options] (file.cnf|file.wcnf|file.bf|file.opb)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Syntax : %s [options] (file.cnf|file.qdimacs|file.wcnf|file.bf|file.opb|file.knf|file.icnf)[.gz|.bz2|.xz|.lzma]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "         %s [options] (directory|glob)\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "         %s [-o file] uncompact map-file model-file\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "         %s [-o file] extend stack-file model-file\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "         %s [-proof-format format] [-core file] [-trimmed file] check-proof file.cnf proof-file\n", os.Args[0])
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 	if help {
 		fmt.Printf("This is GoPreProcessor version 1.0, a SAT pre-processor by Michael Behr and Jared Lenos.\n")
-		fmt.Printf("Syntax : %s [options] (file.cnf|file.wcnf|file.bf|file.opb)\n", os.Args[0])
+		fmt.Printf("Syntax : %s [options] (file.cnf|file.qdimacs|file.wcnf|file.bf|file.opb|file.knf|file.icnf)[.gz|.bz2|.xz|.lzma]\n", os.Args[0])
+		fmt.Printf("         %s [options] (directory|glob)\n", os.Args[0])
+		fmt.Printf("         %s [-o file] uncompact map-file model-file\n", os.Args[0])
+		fmt.Printf("         %s [-o file] extend stack-file model-file\n", os.Args[0])
+		fmt.Printf("         %s [-proof-format format] [-core file] [-trimmed file] check-proof file.cnf proof-file\n", os.Args[0])
+		fmt.Printf("Given a directory or a glob, e.g 'bench/*.cnf', all the formulas it contains are preprocessed, and a summary is written.\n")
+		fmt.Printf("uncompact maps a model of a compacted formula back to the original vars. The map file can be the compacted formula itself.\n")
+		fmt.Printf("extend turns a model of a simplified formula into a model of the original formula, using the stack written with -stack.\n")
+		fmt.Printf("When the formula was also compacted, the model must be uncompacted before being extended.\n")
+		fmt.Printf("check-proof checks a DRAT or LRAT proof of the formula, e.g one written with -proof, and outputs s VERIFIED if it derives the empty clause.\n")
 		flag.PrintDefaults()
 		os.Exit(0)
 	}
+	proofFormat, ok := proofFormats[proofFmt]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "invalid proof format %q\n", proofFmt)
+		os.Exit(1)
+	}
+	if cmd == "check-proof" {
+		if err := checkProof(flag.Arg(1), flag.Arg(2), proofFormat, corePath, trimPath); err != nil {
+			fmt.Printf("s NOT VERIFIED\n")
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if cmd != "" {
+		if err := convertModel(cmd, flag.Arg(1), flag.Arg(2), outPath); err != nil {
+			fmt.Fprintf(os.Stderr, "could not %s model: %v\n", cmd, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if grow < 0 || maxRes < 0 || effort < 0 || probe < 0 {
+		fmt.Fprintf(os.Stderr, "invalid growth %d, resolvent length %d, cover effort %d or probe limit %d\n", grow, maxRes, effort, probe)
+		os.Exit(1)
+	}
+	opts := &Preprocessor.Options{Grow: grow, MaxResolventLen: maxRes, CoverEffort: effort, ProbeLimit: probe}
 	path := flag.Args()[0]
-	fmt.Printf("c solving %s\n", path)
-	if strings.HasSuffix(path, ".cnf") {
-		if pb, err := parse(flag.Args()[0]); err != nil {
+	comp, err := Preprocessor.ParseCompression(compress)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if isBatch(path) {
+		if outPath != "" || stack != "" || proof != "" || mapPath != "" || statPath != "" {
+			fmt.Fprintf(os.Stderr, "-o, -stack, -proof, -map and -stats-json are not available in batch mode\n")
+			os.Exit(1)
+		}
+		if jobs < 1 || (xorCNF && xorCut < 3) {
+			fmt.Fprintf(os.Stderr, "invalid nb of jobs %d or xor cutting length %d\n", jobs, xorCut)
+			os.Exit(1)
+		}
+		mode := Preprocessor.Strict
+		if lenient {
+			mode = Preprocessor.Lenient
+		}
+		bopts := &batchOptions{encoding: encoding, mode: mode, xorCNF: xorCNF, xorCut: xorCut, cardCNF: cardCNF,
+			compact: compact, compress: compress, outDir: outDir, jobs: jobs, pre: opts}
+		if err := runBatch(path, bopts, summary); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if compress == "" && outPath != "" {
+		comp = Preprocessor.CompressionFromPath(outPath)
+	}
+	// the formulas are only displayed if the simplified formula is written uncompressed on stdout
+	display := comp == Preprocessor.NoCompression && outPath == ""
+	name := Preprocessor.TrimCompressionExt(path)
+	if (compact || stack != "" || statPath != "") && (strings.HasSuffix(name, ".opb") || strings.HasSuffix(name, ".knf") || strings.HasSuffix(name, ".icnf")) {
+		fmt.Fprintf(os.Stderr, "compaction, reconstruction stacks and statistics are only available for CNF, QDIMACS, WCNF and BF formulas\n")
+		os.Exit(1)
+	}
+	if proof != "" && (compact || !strings.HasSuffix(name, ".cnf")) {
+		fmt.Fprintf(os.Stderr, "proofs are only available for CNF formulas, and not with -compact\n")
+		os.Exit(1)
+	}
+	if display {
+		fmt.Printf("c solving %s\n", path)
+	}
+	mode := Preprocessor.Strict
+	if lenient {
+		mode = Preprocessor.Lenient
+	}
+	if strings.HasSuffix(name, ".cnf") || strings.HasSuffix(name, ".qdimacs") {
+		if pb, err := parse(path, mode); err != nil {
+			fmt.Fprintf(os.Stderr, "could not parse problem: %v\n", err)
+			os.Exit(1)
+		} else if pb.QBF() {
+			if display {
+				show("QDIMACS FORMULA", pb.WriteQDIMACS)
+			}
+			// run pre-processing, only innermost existential vars are eliminated
+			pb.Options = opts
+			pb.Preprocess()
+			saveStack(pb, stack)
+			saveStats(pb, statPath, path)
+			output(compacted(pb, pb.WriteQDIMACS, compact, mapPath), comp, outPath)
+		} else {
+			if display {
+				show("CNF FORMULA", pb.WriteDIMACS)
+			}
+			// run pre-processing
+			pb.Options = opts
+			endProof := startProof(pb, proof, proofFormat)
+			pb.Preprocess()
+			endProof()
+			if xorCNF {
+				if xorCut < 3 {
+					fmt.Fprintf(os.Stderr, "invalid xor cutting length %d\n", xorCut)
+					os.Exit(1)
+				}
+				pb.ExpandXors(xorCut)
+			}
+			saveStack(pb, stack)
+			saveStats(pb, statPath, path)
+			output(compacted(pb, pb.WriteDIMACS, compact, mapPath), comp, outPath)
+		}
+	} else if strings.HasSuffix(name, ".wcnf") {
+		if pb, err := parse(path, mode); err != nil {
+			fmt.Fprintf(os.Stderr, "could not parse problem: %v\n", err)
+			os.Exit(1)
+		} else {
+			if display {
+				show("WCNF FORMULA", pb.WriteWCNF)
+			}
+			// run pre-processing, the vars of the cost function are kept
+			pb.Options = opts
+			pb.Preprocess()
+			saveStack(pb, stack)
+			saveStats(pb, statPath, path)
+			output(compacted(pb, pb.WriteWCNF, compact, mapPath), comp, outPath)
+		}
+	} else if strings.HasSuffix(name, ".opb") {
+		if pb, err := parseOPB(path); err != nil {
 			fmt.Fprintf(os.Stderr, "could not parse problem: %v\n", err)
 			os.Exit(1)
 		} else {
-			fmt.Printf("\nCNF FORMULA:\n\n",pb.CNF())
+			if display {
+				show("PB FORMULA", pb.WriteOPB)
+			}
 			// run pre-processing
+			pb.Options = &preprocess.Options{Grow: grow, MaxResolventLen: maxRes}
 			pb.Preprocess()
-			fmt.Printf("\nSIMPLIFIED FORMULA:\n\n",pb.CNF())
+			output(pb.WriteOPB, comp, outPath)
+		}
+	} else if strings.HasSuffix(name, ".knf") {
+		if pb, err := parseKNF(path); err != nil {
+			fmt.Fprintf(os.Stderr, "could not parse problem: %v\n", err)
+			os.Exit(1)
+		} else {
+			if display {
+				show("KNF FORMULA", pb.WriteKNF)
+			}
+			// run pre-processing
+			pb.Options = &preprocess.Options{Grow: grow, MaxResolventLen: maxRes}
+			pb.Preprocess()
+			if cardCNF {
+				pb.EncodeCards()
+				output(pb.WriteDIMACS, comp, outPath)
+			} else {
+				output(pb.WriteKNF, comp, outPath)
+			}
+		}
+	} else if strings.HasSuffix(name, ".icnf") {
+		if inc, err := parseICNF(path); err != nil {
+			fmt.Fprintf(os.Stderr, "could not parse problem: %v\n", err)
+			os.Exit(1)
+		} else {
+			if display {
+				show("ICNF FORMULA", inc.WriteICNF)
+			}
+			// run pre-processing, the vars of the assumptions are kept
+			inc.Options = opts
+			inc.Preprocess()
+			output(inc.WriteICNF, comp, outPath)
+		}
+	} else if strings.HasSuffix(name, ".bf") {
+		if pb, err := parseBF(path, encoding); err != nil {
+			fmt.Fprintf(os.Stderr, "could not parse problem: %v\n", err)
+			os.Exit(1)
+		} else {
+			if display {
+				show("CNF FORMULA", pb.WriteDIMACS)
+			}
+			// run pre-processing
+			pb.Options = opts
+			pb.Preprocess()
+			saveStack(pb, stack)
+			saveStats(pb, statPath, path)
+			output(compacted(pb, pb.WriteDIMACS, compact, mapPath), comp, outPath)
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "Could not parse problem. Make sure it is in CNF, QDIMACS, WCNF, OPB, KNF, iCNF or BF form.")
+	}
+
+}
+
+// show displays a formula on stdout, after the given title.
+func show(title string, write func(io.Writer) error) {
+	fmt.Printf("\n%s:\n\n", title)
+	if err := write(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "could not display formula: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// output writes the simplified formula to outPath, or on stdout if outPath is empty.
+// The formula is compressed if a compression format was given, else on stdout it is displayed like the original formula.
+func output(write func(io.Writer) error, comp Preprocessor.Compression, outPath string) {
+	if outPath == "" && comp == Preprocessor.NoCompression {
+		show("SIMPLIFIED FORMULA", write)
+		return
+	}
+	out := os.Stdout
+	if outPath != "" {
+		f, err := os.Create(outPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not create output file: %v\n", err)
+			os.Exit(1)
+		}
+		out = f
+	}
+	w, err := Preprocessor.NewWriter(out, comp)
+	if err == nil {
+		if err = write(w); err == nil {
+			err = w.Close()
+		}
+	}
+	if outPath != "" {
+		if err2 := out.Close(); err == nil {
+			err = err2
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not write output: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// compacted compacts pb if requested, and returns the function writing the compacted formula.
+// The var map is written to mapPath, or embedded at the beginning of the formula if mapPath is empty.
+func compacted(pb *Preprocessor.Problem, write func(io.Writer) error, compact bool, mapPath string) func(io.Writer) error {
+	if !compact {
+		return write
+	}
+	vm := pb.Compact()
+	if mapPath == "" {
+		return func(w io.Writer) error {
+			if err := vm.Write(w); err != nil {
+				return err
+			}
+			return write(w)
+		}
+	}
+	f, err := os.Create(mapPath)
+	if err == nil {
+		err = vm.Write(f)
+		if err2 := f.Close(); err == nil {
+			err = err2
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not write var map: %v\n", err)
+		os.Exit(1)
+	}
+	return write
+}
+
+// proofFormats associates the values of the -proof-format flag with the corresponding format.
+var proofFormats = map[string]Preprocessor.ProofFormat{
+	"drat":        Preprocessor.DRAT,
+	"binary-drat": Preprocessor.BinaryDRAT,
+	"lrat":        Preprocessor.LRAT,
+}
+
+// startProof makes pb write a proof in the given format to path, if path is not empty, and returns the function
+// that must be called to finish writing the proof once the problem was preprocessed.
+func startProof(pb *Preprocessor.Problem, path string, format Preprocessor.ProofFormat) (endProof func()) {
+	if path == "" {
+		return func() {}
+	}
+	if pb.QBF() || len(pb.Xors) != 0 {
+		fmt.Fprintf(os.Stderr, "proofs are not available for QBFs and xor constraints\n")
+		os.Exit(1)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not create proof file: %v\n", err)
+		os.Exit(1)
+	}
+	w, err := Preprocessor.NewWriter(f, Preprocessor.CompressionFromPath(path))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not write proof: %v\n", err)
+		os.Exit(1)
+	}
+	pb.SetProof(w, format)
+	return func() {
+		err := pb.FlushProof()
+		if err2 := w.Close(); err == nil {
+			err = err2
+		}
+		if err2 := f.Close(); err == nil {
+			err = err2
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not write proof: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// saveStats writes the statistics about the preprocessing of pb, read from the file at input, to path, if path is not empty.
+func saveStats(pb *Preprocessor.Problem, path, input string) {
+	if path == "" {
+		return
+	}
+	pb.Stats.File = input
+	f, err := os.Create(path)
+	if err == nil {
+		err = pb.Stats.WriteJSON(f)
+		if err2 := f.Close(); err == nil {
+			err = err2
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not write statistics: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// saveStack writes the reconstruction stack of pb to path, if path is not empty.
+func saveStack(pb *Preprocessor.Problem, path string) {
+	if path == "" {
+		return
+	}
+	f, err := os.Create(path)
+	if err == nil {
+		err = pb.WriteStack(f)
+		if err2 := f.Close(); err == nil {
+			err = err2
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not write reconstruction stack: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// convertModel reads the model at modelPath ("-" for stdin) and converts it, either with
+// the var map at auxPath (cmd "uncompact") or with the reconstruction stack at auxPath (cmd "extend").
+// The resulting model is written to outPath, or on stdout if outPath is empty.
+func convertModel(cmd, auxPath, modelPath, outPath string) error {
+	f, err := openInput(auxPath)
+	if err != nil {
+		return err
+	}
+	var convert func([]Preprocessor.Lit) ([]Preprocessor.Lit, error)
+	if cmd == "uncompact" {
+		vm, err := Preprocessor.ParseVarMap(f)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("could not parse var map %q: %v", auxPath, err)
+		}
+		convert = vm.Uncompact
+	} else {
+		st, err := Preprocessor.ParseStack(f)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("could not parse stack %q: %v", auxPath, err)
+		}
+		convert = st.Extend
+	}
+	f.Close()
+	var in io.ReadCloser = os.Stdin
+	if modelPath != "-" {
+		if in, err = openInput(modelPath); err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+	status, model, err := Preprocessor.ParseModel(in)
+	if err != nil {
+		return fmt.Errorf("could not parse model %q: %v", modelPath, err)
+	}
+	if status == Preprocessor.Sat {
+		if model, err = convert(model); err != nil {
+			return err
 		}
-	} else{
-		fmt.Fprintf(os.Stderr, "Could not parse problem. Make sure it is in CNF form.")
 	}
+	out := os.Stdout
+	if outPath != "" {
+		if out, err = os.Create(outPath); err != nil {
+			return err
+		}
+	}
+	err = Preprocessor.WriteModel(out, status, model)
+	if outPath != "" {
+		if err2 := out.Close(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
 
+// checkProof checks the proof at proofPath, in the given format, for the CNF formula at path.
+// If the proof is a refutation, the core and the trimmed proof are written to corePath and trimPath, if not empty.
+func checkProof(path, proofPath string, format Preprocessor.ProofFormat, corePath, trimPath string) error {
+	pb, err := parse(path, Preprocessor.Strict)
+	if err != nil {
+		return err
+	}
+	f, err := openInput(proofPath)
+	if err != nil {
+		return err
+	}
+	steps, err := Preprocessor.ParseProof(f, format)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("could not parse proof %q: %v", proofPath, err)
+	}
+	res, err := pb.CheckProof(steps, format)
+	if err != nil {
+		return fmt.Errorf("invalid proof: %v", err)
+	}
+	if !res.Refutation {
+		fmt.Printf("c all %d steps are valid, but the empty clause is not derived\n", len(steps))
+		fmt.Printf("s DERIVATION VERIFIED\n")
+		return nil
+	}
+	fmt.Printf("c core: %d/%d clauses, trimmed proof: %d/%d steps\n", len(res.Core), len(pb.Clauses), len(res.Trimmed), len(steps))
+	if corePath != "" {
+		if err := writeFile(corePath, func(w io.Writer) error { return pb.WriteCore(w, res.Core) }); err != nil {
+			return fmt.Errorf("could not write core: %v", err)
+		}
+	}
+	if trimPath != "" {
+		if err := writeFile(trimPath, func(w io.Writer) error { return Preprocessor.WriteProof(w, res.Trimmed, format) }); err != nil {
+			return fmt.Errorf("could not write trimmed proof: %v", err)
+		}
+	}
+	fmt.Printf("s VERIFIED\n")
+	return nil
 }
-func parse(path string) (pb *Preprocessor.Problem, err error) {
+
+// writeFile writes a file at path with write, compressed according to its extension.
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w, err := Preprocessor.NewWriter(f, Preprocessor.CompressionFromPath(path))
+	if err == nil {
+		err = write(w)
+		if err2 := w.Close(); err == nil {
+			err = err2
+		}
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// openInput opens the file at path, decompressing it on the fly if needed.
+func openInput(path string) (io.ReadCloser, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("could not open %q: %v", path, err)
 	}
+	r, err := Preprocessor.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not read %q: %v", path, err)
+	}
+	return inputFile{ReadCloser: r, f: f}, nil
+}
+
+// inputFile closes both the decompressor and the underlying file.
+type inputFile struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (in inputFile) Close() error {
+	err := in.ReadCloser.Close()
+	in.f.Close()
+	return err
+}
+
+func parse(path string, mode Preprocessor.ParseMode) (pb *Preprocessor.Problem, err error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
 	defer f.Close()
-	if strings.HasSuffix(path, ".cnf") {
-		pb, err := Preprocessor.ParseCNF(f)
+	name := Preprocessor.TrimCompressionExt(path)
+	if strings.HasSuffix(name, ".cnf") || strings.HasSuffix(name, ".qdimacs") {
+		pb, warnings, err := Preprocessor.ParseCNFMode(f, mode)
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s: %v\n", path, w)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("could not parse DIMACS file %q: %v", path, err)
 		}
-		return pb,nil
+		return pb, nil
+	}
+	if strings.HasSuffix(name, ".wcnf") {
+		pb, err := Preprocessor.ParseWCNF(f)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse WCNF file %q: %v", path, err)
+		}
+		return pb, nil
 	}
 	return nil, fmt.Errorf("invalid file format for %q", path)
-}
\ No newline at end of file
+}
+
+func parseOPB(path string) (*preprocess.Problem, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pb, err := preprocess.ParseOPB(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse OPB file %q: %v", path, err)
+	}
+	return pb, nil
+}
+
+func parseKNF(path string) (*preprocess.Problem, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pb, err := preprocess.ParseKNF(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse KNF file %q: %v", path, err)
+	}
+	return pb, nil
+}
+
+func parseICNF(path string) (*Preprocessor.Incremental, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	inc, err := Preprocessor.ParseICNF(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse iCNF file %q: %v", path, err)
+	}
+	return inc, nil
+}
+
+func parseBF(path, encoding string) (*Preprocessor.Problem, error) {
+	var enc Preprocessor.Encoding
+	switch encoding {
+	case "tseitin":
+		enc = Preprocessor.Tseitin
+	case "pg":
+		enc = Preprocessor.PlaistedGreenbaum
+	default:
+		return nil, fmt.Errorf("invalid encoding %q", encoding)
+	}
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pb, err := Preprocessor.ParseBF(f, enc)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse formula file %q: %v", path, err)
+	}
+	return pb, nil
+}
@@ -146,6 +146,12 @@ func (c *Clause) Get(i int) Lit {
 	return c.lits[i]
 }
 
+// Sort sorts the lits of the clause in increasing order.
+// Must not be called on PB constraints, since weights would not follow their lits.
+func (c *Clause) Sort() {
+	sort.Slice(c.lits, func(i, j int) bool { return c.lits[i] < c.lits[j] })
+}
+
 // Set sets the ith literal of the clause.
 func (c *Clause) Set(i int, l Lit) {
 	c.lits[i] = l
@@ -0,0 +1,230 @@
+package preprocess
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ParseKNF parses a file in the KNF format, an extension of DIMACS with cardinality constraints,
+// and returns the corresponding Problem.
+// The header is "p knf nbvars nbconstraints", and a line "k <bound> lits 0" states that
+// at least bound of the lits must be true. Other lines are regular DIMACS clauses.
+// Cardinality constraints are normalized the same way as OPB constraints, so a constraint with
+// bound 1 becomes a clause. Duplicate lits are rejected in cardinality constraints, since they would
+// turn them into PB constraints, which cannot be represented in KNF.
+// The problem is not simplified: it is up to the caller to call Preprocess.
+func ParseKNF(f io.Reader) (*Problem, error) {
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024*1024)
+	var (
+		pb     Problem
+		header = false
+		lits   []Lit // Lits of the current clause, which can span several lines
+		lineNb = 0
+	)
+	for sc.Scan() {
+		lineNb++
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || fields[0][0] == 'c' {
+			continue
+		}
+		if fields[0] == "p" {
+			if header {
+				return nil, fmt.Errorf("line %d: duplicate header", lineNb)
+			}
+			if err := pb.parseKNFHeader(fields); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNb, err)
+			}
+			header = true
+			continue
+		}
+		if !header {
+			return nil, fmt.Errorf("line %d: constraint found before header", lineNb)
+		}
+		if fields[0] == "k" {
+			if len(lits) != 0 {
+				return nil, fmt.Errorf("line %d: cardinality constraint found inside a clause", lineNb)
+			}
+			if err := pb.parseKNFCard(fields[1:]); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNb, err)
+			}
+			continue
+		}
+		for _, field := range fields {
+			lit, end, err := pb.parseKNFLit(field)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNb, err)
+			}
+			if !end {
+				lits = append(lits, lit)
+				continue
+			}
+			if len(lits) == 0 {
+				pb.Status = Unsat
+			} else if err := pb.addPBConstr(onesTerms(lits), big.NewInt(1)); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNb, err)
+			}
+			lits = nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("could not read KNF: %v", err)
+	}
+	if len(lits) != 0 {
+		return nil, fmt.Errorf("line %d: unfinished clause while EOF found", lineNb)
+	}
+	pb.Model = make([]decLevel, pb.NbVars)
+	if pb.Status == Unsat {
+		pb.Clauses = nil
+	}
+	return &pb, nil
+}
+
+// parseKNFHeader parses a "p knf nbvars nbconstraints" line.
+func (pb *Problem) parseKNFHeader(fields []string) error {
+	if len(fields) != 4 || fields[1] != "knf" {
+		return fmt.Errorf("invalid syntax %q in header", strings.Join(fields, " "))
+	}
+	nbVars, err := strconv.Atoi(fields[2])
+	if err != nil || nbVars < 0 {
+		return fmt.Errorf("nbvars not a positive int : %q", fields[2])
+	}
+	nbConstrs, err := strconv.Atoi(fields[3])
+	if err != nil || nbConstrs < 0 {
+		return fmt.Errorf("nbConstraints not a positive int : %q", fields[3])
+	}
+	pb.NbVars = nbVars
+	pb.Clauses = make([]*Clause, 0, nbConstrs)
+	return nil
+}
+
+// parseKNFLit parses a DIMACS lit. end is true iff the lit was 0.
+func (pb *Problem) parseKNFLit(field string) (lit Lit, end bool, err error) {
+	val, err := strconv.ParseInt(field, 10, 32)
+	if err != nil || val == -1<<31 {
+		return 0, false, fmt.Errorf("invalid literal %q", field)
+	}
+	if val == 0 {
+		return 0, true, nil
+	}
+	if val > int64(pb.NbVars) || -val > int64(pb.NbVars) {
+		return 0, false, fmt.Errorf("invalid literal %d for problem with %d vars only", val, pb.NbVars)
+	}
+	return IntToLit(int32(val)), false, nil
+}
+
+// parseKNFCard parses the fields of a "k <bound> lits 0" line, after the "k".
+func (pb *Problem) parseKNFCard(fields []string) error {
+	if len(fields) < 2 || fields[len(fields)-1] != "0" {
+		return fmt.Errorf("cardinality constraint does not end with 0")
+	}
+	bound, ok := new(big.Int).SetString(fields[0], 10)
+	if !ok {
+		return fmt.Errorf("invalid bound %q", fields[0])
+	}
+	lits := make([]Lit, 0, len(fields)-2)
+	seen := make(map[Lit]bool, len(fields)-2)
+	for _, field := range fields[1 : len(fields)-1] {
+		lit, end, err := pb.parseKNFLit(field)
+		if err != nil {
+			return err
+		}
+		if end {
+			return fmt.Errorf("unexpected 0 inside cardinality constraint")
+		}
+		if seen[lit] {
+			return fmt.Errorf("duplicate literal %d in cardinality constraint", lit.Int())
+		}
+		seen[lit] = true
+		lits = append(lits, lit)
+	}
+	return pb.addPBConstr(onesTerms(lits), bound)
+}
+
+// onesTerms returns the terms of the sum of lits, all with weight 1.
+func onesTerms(lits []Lit) []pbTerm {
+	terms := make([]pbTerm, len(lits))
+	for i, lit := range lits {
+		terms[i] = pbTerm{lit: lit, weight: big.NewInt(1)}
+	}
+	return terms
+}
+
+// KNF returns a KNF representation of the problem, as written by WriteKNF.
+func (pb *Problem) KNF() string {
+	return toString(pb.WriteKNF)
+}
+
+// newVar adds a fresh var to the problem and returns it.
+func (pb *Problem) newVar() Var {
+	v := Var(pb.NbVars)
+	pb.NbVars++
+	pb.Model = append(pb.Model, 0)
+	return v
+}
+
+// EncodeCards replaces each cardinality constraint by equivalent clauses,
+// using Sinz's sequential counter: at least k lits among n are true iff at most n-k of their negations are.
+// It panics if the problem contains PB constraints.
+func (pb *Problem) EncodeCards() {
+	var clauses []*Clause
+	for _, c := range pb.Clauses {
+		if c.PseudoBoolean() {
+			panic("PB constraints cannot be encoded as cardinality constraints")
+		}
+		card := c.Cardinality()
+		if card == 1 {
+			clauses = append(clauses, c)
+			continue
+		}
+		negs := make([]Lit, c.Len())
+		for i, lit := range c.lits {
+			negs[i] = lit.Negation()
+		}
+		clauses = append(clauses, pb.atMost(negs, c.Len()-card)...)
+	}
+	pb.Clauses = clauses
+}
+
+// atMost returns clauses stating that at most k lits are true, with the sequential counter encoding.
+// s[i][j] means that at least j+1 lits among lits[0..i] are true.
+func (pb *Problem) atMost(lits []Lit, k int) []*Clause {
+	var res []*Clause
+	add := func(lits ...Lit) { res = append(res, NewClause(lits)) }
+	n := len(lits)
+	if k == 0 {
+		for _, lit := range lits {
+			add(lit.Negation())
+		}
+		return res
+	}
+	if k >= n {
+		return nil
+	}
+	s := make([][]Lit, n-1)
+	for i := range s {
+		s[i] = make([]Lit, k)
+		for j := range s[i] {
+			s[i][j] = pb.newVar().Lit()
+		}
+	}
+	add(lits[0].Negation(), s[0][0])
+	for j := 1; j < k; j++ {
+		add(s[0][j].Negation())
+	}
+	for i := 1; i < n-1; i++ {
+		add(lits[i].Negation(), s[i][0])
+		add(s[i-1][0].Negation(), s[i][0])
+		for j := 1; j < k; j++ {
+			add(lits[i].Negation(), s[i-1][j-1].Negation(), s[i][j])
+			add(s[i-1][j].Negation(), s[i][j])
+		}
+		add(lits[i].Negation(), s[i-1][k-1].Negation())
+	}
+	add(lits[n-1].Negation(), s[n-2][k-1].Negation())
+	return res
+}
@@ -0,0 +1,54 @@
+package preprocess
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseKNF(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string // Expected error, or "" if the file must be accepted
+		want  string // Expected KNF output of the parsed problem
+	}{
+		{
+			name:  "duplicate literal in cardinality constraint",
+			input: "p knf 4 1\nk 3 1 1 2 3 4 0\n",
+			err:   "line 2: duplicate literal 1 in cardinality constraint",
+		},
+		{
+			name:  "duplicate literal in clause",
+			input: "p knf 2 1\n1 1 2 0\n",
+			want:  "p knf 2 1\n1 2 0\n",
+		},
+		{ // 1 and -1 are never both false, so at least 1 of 2 and 3 must be true
+			name:  "complementary literals in cardinality constraint",
+			input: "p knf 3 1\nk 2 1 -1 2 3 0\n",
+			want:  "p knf 3 1\n2 3 0\n",
+		},
+		{ // Preprocessing is left to the caller
+			name:  "units are not propagated",
+			input: "p knf 3 2\nk 2 1 2 3 0\n-1 0\n",
+			want:  "p knf 3 2\nk 2 1 2 3 0\n-1 0\n",
+		},
+	}
+	for _, test := range tests {
+		pb, err := ParseKNF(strings.NewReader(test.input))
+		if test.err != "" {
+			if err == nil {
+				t.Errorf("%s: expected error %q, got none", test.name, test.err)
+			} else if err.Error() != test.err {
+				t.Errorf("%s: expected error %q, got %q", test.name, test.err, err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %q", test.name, err.Error())
+			continue
+		}
+		if got := pb.KNF(); got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package preprocess
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxCard is the biggest cardinality a constraint can have, since it is stored on 30 bits in lbdValue.
+const maxCard = 1<<30 - 1
+
+// A pbTerm is a weighted literal, as read in an OPB file.
+type pbTerm struct {
+	lit    Lit
+	weight *big.Int
+}
+
+// ParseOPB parses a file in the OPB (pseudo-boolean) format and returns the corresponding Problem.
+// Constraints can use the >=, <= and = operators, and literals can be negated with ~.
+// Coefficients are read as arbitrary-precision ints, so that overflows are detected instead of
+// silently producing a wrong problem.
+// Constraints are normalized: they are stored as PB constraints with strictly positive weights,
+// or as cardinality constraints or clauses when possible.
+func ParseOPB(f io.Reader) (*Problem, error) {
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024*1024)
+	var (
+		pb       Problem
+		declared = -1 // nb of vars declared in the header, if any
+		tokens   []string
+		lineNb   = 0
+	)
+	for sc.Scan() {
+		lineNb++
+		line := sc.Text()
+		if strings.HasPrefix(line, "*") {
+			if declared == -1 {
+				declared = parseOPBHeader(line)
+			}
+			continue
+		}
+		for _, tok := range strings.Fields(strings.Replace(line, ";", " ; ", -1)) {
+			if tok != ";" {
+				tokens = append(tokens, tok)
+				continue
+			}
+			if err := pb.parseOPBStatement(tokens, declared); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNb, err)
+			}
+			tokens = tokens[:0]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("could not read OPB: %v", err)
+	}
+	if len(tokens) != 0 {
+		return nil, fmt.Errorf("line %d: unfinished constraint while EOF found", lineNb)
+	}
+	if declared > pb.NbVars {
+		pb.NbVars = declared
+	}
+	pb.Model = make([]decLevel, pb.NbVars)
+	if pb.Status == Unsat {
+		pb.Clauses = nil
+		return &pb, nil
+	}
+	pb.simplifyPB()
+	return &pb, nil
+}
+
+// parseOPBHeader returns the nb of vars declared in a "* #variable= n #constraint= m" comment,
+// or -1 if the line is a regular comment.
+func parseOPBHeader(line string) int {
+	fields := strings.Fields(line)
+	for i := 0; i < len(fields)-1; i++ {
+		if fields[i] == "#variable=" {
+			if nbVars, err := strconv.Atoi(fields[i+1]); err == nil && nbVars >= 0 {
+				return nbVars
+			}
+		}
+	}
+	return -1
+}
+
+// parseOPBStatement parses the tokens of the objective function or of a constraint, without the final ';'.
+func (pb *Problem) parseOPBStatement(tokens []string, declared int) error {
+	if len(tokens) == 0 {
+		return fmt.Errorf("empty constraint")
+	}
+	if tokens[0] == "min:" {
+		if pb.minLits != nil {
+			return fmt.Errorf("duplicate objective function")
+		}
+		return pb.parseOPBObjective(tokens[1:], declared)
+	}
+	if len(tokens) < 2 {
+		return fmt.Errorf("invalid constraint %q", strings.Join(tokens, " "))
+	}
+	op := tokens[len(tokens)-2]
+	rhs, ok := new(big.Int).SetString(tokens[len(tokens)-1], 10)
+	if !ok {
+		return fmt.Errorf("invalid right-hand side %q", tokens[len(tokens)-1])
+	}
+	terms, err := pb.parseOPBTerms(tokens[:len(tokens)-2], declared)
+	if err != nil {
+		return err
+	}
+	switch op {
+	case ">=":
+		return pb.addPBConstr(terms, rhs)
+	case "<=":
+		return pb.addPBConstr(negateTerms(terms), new(big.Int).Neg(rhs))
+	case "=":
+		if err := pb.addPBConstr(terms, rhs); err != nil {
+			return err
+		}
+		return pb.addPBConstr(negateTerms(terms), new(big.Int).Neg(rhs))
+	default:
+		return fmt.Errorf("invalid operator %q", op)
+	}
+}
+
+// parseOPBObjective parses the terms of a "min:" line and sets the cost function accordingly.
+func (pb *Problem) parseOPBObjective(tokens []string, declared int) error {
+	terms, err := pb.parseOPBTerms(tokens, declared)
+	if err != nil {
+		return err
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+	lits := make([]Lit, len(terms))
+	weights := make([]int, len(terms))
+	for i, term := range terms {
+		if !fitsInt(term.weight) {
+			return fmt.Errorf("coefficient %s of the objective function is too large", term.weight)
+		}
+		lits[i] = term.lit
+		weights[i] = int(term.weight.Int64())
+	}
+	pb.SetCostFunc(lits, weights)
+	return nil
+}
+
+// parseOPBTerms parses a list of "coeff lit" terms.
+// If declared is not -1, every var must be lower or equal to it.
+func (pb *Problem) parseOPBTerms(tokens []string, declared int) ([]pbTerm, error) {
+	if len(tokens)%2 != 0 {
+		return nil, fmt.Errorf("invalid terms %q: non-linear constraints are not supported", strings.Join(tokens, " "))
+	}
+	terms := make([]pbTerm, 0, len(tokens)/2)
+	for i := 0; i < len(tokens); i += 2 {
+		weight, ok := new(big.Int).SetString(strings.TrimPrefix(tokens[i], "+"), 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid coefficient %q", tokens[i])
+		}
+		lit, err := pb.parseOPBLit(tokens[i+1], declared)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, pbTerm{lit: lit, weight: weight})
+	}
+	return terms, nil
+}
+
+// parseOPBLit parses a lit of the form "x12" or "~x12".
+func (pb *Problem) parseOPBLit(tok string, declared int) (Lit, error) {
+	neg := strings.HasPrefix(tok, "~")
+	name := strings.TrimPrefix(tok, "~")
+	if !strings.HasPrefix(name, "x") {
+		return 0, fmt.Errorf("invalid literal %q", tok)
+	}
+	val, err := strconv.ParseInt(name[1:], 10, 32)
+	if err != nil || val <= 0 {
+		return 0, fmt.Errorf("invalid literal %q", tok)
+	}
+	if declared != -1 && int(val) > declared {
+		return 0, fmt.Errorf("invalid literal %q for problem with %d vars only", tok, declared)
+	}
+	if int(val) > pb.NbVars {
+		pb.NbVars = int(val)
+	}
+	return IntToVar(int32(val)).SignedLit(neg), nil
+}
+
+// negateTerms returns the terms with all their weights negated.
+func negateTerms(terms []pbTerm) []pbTerm {
+	res := make([]pbTerm, len(terms))
+	for i, term := range terms {
+		res[i] = pbTerm{lit: term.lit, weight: new(big.Int).Neg(term.weight)}
+	}
+	return res
+}
+
+// fitsInt returns true iff n can be stored in an int.
+func fitsInt(n *big.Int) bool {
+	return n.IsInt64() && n.Int64() == int64(int(n.Int64()))
+}
+
+// addPBConstr adds the constraint sum(terms) >= rhs to the problem.
+// The constraint is first normalized: terms on the same var are merged,
+// negative weights are removed by negating their lit and updating the right-hand side,
+// weights bigger than the right-hand side are saturated and all weights are divided by their gcd.
+// Trivially satisfied constraints are ignored, and unsatisfiable ones make the problem UNSAT.
+func (pb *Problem) addPBConstr(terms []pbTerm, rhs *big.Int) error {
+	card := new(big.Int).Set(rhs)
+	coeffs := make(map[Var]*big.Int, len(terms)) // Weight of the positive lit of each var
+	vars := make([]Var, 0, len(terms))           // Vars in order of appearance
+	for _, term := range terms {
+		v := term.lit.Var()
+		if coeffs[v] == nil {
+			coeffs[v] = new(big.Int)
+			vars = append(vars, v)
+		}
+		if term.lit.IsPositive() {
+			coeffs[v].Add(coeffs[v], term.weight)
+		} else { // w.~x = w - w.x
+			coeffs[v].Sub(coeffs[v], term.weight)
+			card.Sub(card, term.weight)
+		}
+	}
+	var (
+		lits    []Lit
+		weights []*big.Int
+	)
+	for _, v := range vars {
+		switch w := coeffs[v]; w.Sign() {
+		case 1:
+			lits = append(lits, v.Lit())
+			weights = append(weights, w)
+		case -1: // w.x = w + |w|.~x
+			card.Sub(card, w)
+			lits = append(lits, v.SignedLit(true))
+			weights = append(weights, new(big.Int).Neg(w))
+		}
+	}
+	if card.Sign() <= 0 { // Trivially satisfied
+		return nil
+	}
+	sum := new(big.Int)
+	gcd := new(big.Int)
+	for _, w := range weights {
+		if w.Cmp(card) > 0 {
+			w.Set(card)
+		}
+		sum.Add(sum, w)
+		gcd.GCD(nil, nil, gcd, w)
+	}
+	if sum.Cmp(card) < 0 {
+		pb.Status = Unsat
+		return nil
+	}
+	if gcd.Cmp(big.NewInt(1)) > 0 { // sum(g.w_i.l_i) >= card iff sum(w_i.l_i) >= ceil(card / g)
+		for _, w := range weights {
+			w.Quo(w, gcd)
+		}
+		card.Add(card, gcd).Sub(card, big.NewInt(1)).Quo(card, gcd)
+		sum.Quo(sum, gcd)
+	}
+	if !fitsInt(sum) || card.Cmp(big.NewInt(maxCard)) > 0 {
+		return fmt.Errorf("coefficients are too large: sum of weights is %s, cardinality is %s", sum, card)
+	}
+	if sum.Cmp(big.NewInt(int64(len(lits)))) == 0 { // All weights are 1
+		if card.Int64() == 1 {
+			pb.Clauses = append(pb.Clauses, NewClause(lits))
+		} else {
+			pb.Clauses = append(pb.Clauses, NewCardClause(lits, int(card.Int64())))
+		}
+		return nil
+	}
+	intWeights := make([]int, len(weights))
+	for i, w := range weights {
+		intWeights[i] = int(w.Int64())
+	}
+	pb.Clauses = append(pb.Clauses, NewPBClause(lits, intWeights, int(card.Int64())))
+	return nil
+}
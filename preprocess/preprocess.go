@@ -56,6 +56,16 @@ func (c *Clause) SelfSubsumes(c2 *Clause) bool {
 	return oneNeg
 }
 
+// contains returns true iff lit is one of the lits of c.
+func (c *Clause) contains(lit Lit) bool {
+	for _, lit2 := range c.lits {
+		if lit2 == lit {
+			return true
+		}
+	}
+	return false
+}
+
 // Simplify simplifies the given clause by removing redundant lits.
 // If the clause is trivially satisfied (i.e contains both a lit and its negation),
 // true is returned. Otherwise, false is returned.
@@ -64,10 +74,10 @@ func (c *Clause) Simplify() (isSat bool) {
 	lits := make([]Lit, 0, len(c.lits))
 	i := 0
 	for i < len(c.lits) {
-		if i < len(c.lits)-1 && c.lits[i] == c.lits[i+1].Negation() {
+		lit := c.lits[i]
+		if len(lits) != 0 && lits[len(lits)-1] == lit.Negation() { // Lits are sorted, duplicates are skipped
 			return true
 		}
-		lit := c.lits[i]
 		lits = append(lits, lit)
 		i++
 		for i < len(c.lits) && c.lits[i] == lit {
@@ -96,89 +106,219 @@ func (c *Clause) Generate(c2 *Clause, v Var) *Clause {
 	return c3
 }
 
+// Preprocess simplifies the problem.
+// Unit propagation is run on every kind of constraint, using cardinality-aware propagation
+// when there is no PB constraint, but vars are only eliminated when the problem is purely propositional.
+func (pb *Problem) Preprocess() {
+	isPB := false
+	for _, c := range pb.Clauses {
+		if c.PseudoBoolean() {
+			isPB = true
+			break
+		}
+	}
+	if isPB {
+		pb.simplifyPB()
+	} else {
+		pb.simplifyCard()
+	}
+	if pb.Status != Indet {
+		return
+	}
+	for _, c := range pb.Clauses {
+		if c.PseudoBoolean() || c.Cardinality() > 1 {
+			return
+		}
+	}
+	pb.preprocess()
+}
+
+// subsumeAndStrengthen removes subsumed clauses and strengthens self-subsumed clauses, until a fixpoint is reached.
+// Each round is a pass over all clauses, followed by unit propagation when strengthening yielded units.
+// A clause subsumed or self-subsumed by c contains either a given lit of c or its negation,
+// so only the clauses containing the var of c that appears the least must be checked.
+func (pb *Problem) subsumeAndStrengthen() {
+	for round := 1; pb.Status == Indet; round++ {
+		nbSubsumed, nbStrengthened, nbUnits := 0, 0, len(pb.Units)
+		occurs := make([][]int, pb.NbVars*2)
+		for i, c := range pb.Clauses {
+			c.Sort()
+			for _, lit := range c.lits {
+				occurs[lit] = append(occurs[lit], i)
+			}
+		}
+		removed := make([]bool, len(pb.Clauses))
+		for i, c := range pb.Clauses {
+			if removed[i] {
+				continue
+			}
+			best := c.First()
+			for _, lit := range c.lits[1:] {
+				if len(occurs[lit])+len(occurs[lit.Negation()]) < len(occurs[best])+len(occurs[best.Negation()]) {
+					best = lit
+				}
+			}
+			for _, lit := range []Lit{best, best.Negation()} {
+				for _, j := range occurs[lit] {
+					d := pb.Clauses[j]
+					if j == i || removed[j] || !d.contains(lit) { // d might have been strengthened since occurs was built
+						continue
+					}
+					if c.Subsumes(d) {
+						removed[j] = true
+						nbSubsumed++
+					} else if c.SelfSubsumes(d) {
+						nbStrengthened++
+						if pb.strengthen(c, d) {
+							removed[j] = true
+						}
+						if pb.Status == Unsat {
+							return
+						}
+					}
+				}
+			}
+		}
+		pb.rmClauses(removed)
+		if len(pb.Units) != nbUnits {
+			pb.simplify2()
+		}
+		log.Printf("Round %d: %d clauses subsumed, %d lits removed by strengthening, %d units found",
+			round, nbSubsumed, nbStrengthened, len(pb.Units)-nbUnits)
+		if nbSubsumed == 0 && nbStrengthened == 0 {
+			return
+		}
+	}
+}
+
+// strengthen removes from d the negation of the only lit of c whose negation is in d.
+// If d becomes a unit, its lit is bound and true is returned, meaning d must be removed.
+func (pb *Problem) strengthen(c, d *Clause) (isUnit bool) {
+	var pivot Lit
+	for _, lit := range c.lits {
+		if d.contains(lit.Negation()) {
+			pivot = lit
+			break
+		}
+	}
+	j := 0
+	for _, lit := range d.lits {
+		if lit != pivot.Negation() { // Order is kept, so d stays sorted
+			d.lits[j] = lit
+			j++
+		}
+	}
+	d.Shrink(j)
+	if d.Len() != 1 {
+		return false
+	}
+	if lit := d.First(); pb.Model[lit.Var()] == 0 {
+		pb.addUnit(lit)
+	} else if (pb.Model[lit.Var()] == 1) != lit.IsPositive() { // Bound by a unit found in the same round
+		pb.Status = Unsat
+	}
+	return true
+}
+
+// boundedResolvents returns the non-tautological resolvents on v of the clauses whose indices are in pos and neg.
+// Like in the Preprocessor package, ok is false if there are more resolvents than clauses plus Options.Grow,
+// or if a resolvent is longer than Options.MaxResolventLen, since eliminating v would make the problem grow too much.
+func (pb *Problem) boundedResolvents(v Var, pos, neg []int) (resolvents []*Clause, ok bool) {
+	opts := pb.options()
+	limit := len(pos) + len(neg) + opts.Grow
+	for _, idx1 := range pos {
+		for _, idx2 := range neg {
+			r := pb.Clauses[idx1].Generate(pb.Clauses[idx2], v)
+			if r.Simplify() {
+				continue
+			}
+			if len(resolvents) == limit || (opts.MaxResolventLen > 0 && r.Len() > opts.MaxResolventLen) {
+				return nil, false
+			}
+			resolvents = append(resolvents, r)
+		}
+	}
+	return resolvents, true
+}
+
+// preprocess removes subsumed clauses, strengthens clauses, and eliminates vars,
+// as long as it doesn't make the problem grow too much.
 func (pb *Problem) preprocess() {
 	log.Printf("Preprocessing... %d clauses currently", len(pb.Clauses))
+	nbKept := 0 // Tautologies must be removed, resolving one with itself would yield the empty clause
+	for _, c := range pb.Clauses {
+		if !c.Simplify() {
+			pb.Clauses[nbKept] = c
+			nbKept++
+		}
+	}
+	pb.Clauses = pb.Clauses[:nbKept]
+	pb.subsumeAndStrengthen()
+	if pb.Status != Indet {
+		return
+	}
+	frozen := make([]bool, pb.NbVars) // Vars of the cost function must not be eliminated
+	for _, lit := range pb.minLits {
+		frozen[lit.Var()] = true
+	}
 	occurs := make([][]int, pb.NbVars*2)
 	for i, c := range pb.Clauses {
 		for j := 0; j < c.Len(); j++ {
 			occurs[c.Get(j)] = append(occurs[c.Get(j)], i)
 		}
 	}
-	modified := true
-	neverModified := true
-	for modified {
+	nbEliminated := 0
+	nbUnits := len(pb.Units)
+	for modified := true; modified; {
 		modified = false
 		for i := 0; i < pb.NbVars; i++ {
-			if pb.Model[i] != 0 {
+			if pb.Model[i] != 0 || frozen[i] {
 				continue
 			}
 			v := Var(i)
 			lit := v.Lit()
-			nbLit := len(occurs[lit])
-			nbLit2 := len(occurs[lit.Negation()])
-			if (nbLit < 10 || nbLit2 < 10) && (nbLit != 0 || nbLit2 != 0) {
-				modified = true
-				neverModified = false
-				// pb.deleted[v] = true
-				log.Printf("%d can be removed: %d and %d", lit.Int(), len(occurs[lit]), len(occurs[lit.Negation()]))
-				for _, idx1 := range occurs[lit] {
-					for _, idx2 := range occurs[lit.Negation()] {
-						c1 := pb.Clauses[idx1]
-						c2 := pb.Clauses[idx2]
-						newC := c1.Generate(c2, v)
-						if !newC.Simplify() {
-							switch newC.Len() {
-							case 0:
-								log.Printf("Inferred UNSAT")
-								pb.Status = Unsat
-								return
-							case 1:
-								log.Printf("Unit %d", newC.First().Int())
-								lit2 := newC.First()
-								if lit2.IsPositive() {
-									if pb.Model[lit2.Var()] == -1 {
-										pb.Status = Unsat
-										return
-									}
-									pb.Model[lit2.Var()] = 1
-								} else {
-									if pb.Model[lit2.Var()] == 1 {
-										pb.Status = Unsat
-										return
-									}
-									pb.Model[lit2.Var()] = -1
-								}
-								pb.Units = append(pb.Units, lit2)
-							default:
-								pb.Clauses = append(pb.Clauses, newC)
-							}
-						}
-					}
-				}
-				nbRemoved := 0
-				for _, idx := range occurs[lit] {
-					pb.Clauses[idx] = pb.Clauses[len(pb.Clauses)-nbRemoved-1]
-					nbRemoved++
+			pos, neg := occurs[lit], occurs[lit.Negation()]
+			if len(pos) == 0 && len(neg) == 0 {
+				continue
+			}
+			resolvents, ok := pb.boundedResolvents(v, pos, neg)
+			if !ok {
+				continue
+			}
+			modified = true
+			nbEliminated++
+			removed := make([]bool, len(pb.Clauses))
+			for _, idx := range pos {
+				removed[idx] = true
+			}
+			for _, idx := range neg {
+				removed[idx] = true
+			}
+			pb.rmClauses(removed)
+			for _, r := range resolvents {
+				switch r.Len() {
+				case 0:
+					pb.Status = Unsat
+				case 1:
+					pb.addUnit(r.First())
+				default:
+					pb.Clauses = append(pb.Clauses, r)
 				}
-				for _, idx := range occurs[lit.Negation()] {
-					pb.Clauses[idx] = pb.Clauses[len(pb.Clauses)-nbRemoved-1]
-					nbRemoved++
+				if pb.Status == Unsat {
+					log.Printf("Inferred UNSAT")
+					return
 				}
-				pb.Clauses = pb.Clauses[:len(pb.Clauses)-nbRemoved]
-				log.Printf("clauses=%s", pb.CNF())
-				// Redo occurs
-				occurs = make([][]int, pb.NbVars*2)
-				for i, c := range pb.Clauses {
-					for j := 0; j < c.Len(); j++ {
-						occurs[c.Get(j)] = append(occurs[c.Get(j)], i)
-					}
+			}
+			occurs = make([][]int, pb.NbVars*2)
+			for i, c := range pb.Clauses {
+				for j := 0; j < c.Len(); j++ {
+					occurs[c.Get(j)] = append(occurs[c.Get(j)], i)
 				}
-				continue
 			}
 		}
 	}
-	if !neverModified {
-		//pb.simplify()
+	if len(pb.Units) != nbUnits {
+		pb.simplify2()
 	}
-	log.Printf("Done. %d clauses now", len(pb.Clauses))
+	log.Printf("Done. %d vars eliminated, %d clauses now", nbEliminated, len(pb.Clauses))
 }
@@ -0,0 +1,80 @@
+package preprocess
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEliminationBounds(t *testing.T) {
+	// All vars but x1 are in the cost function, so only x1 can be eliminated.
+	// Eliminating it replaces its 6 clauses by 9 resolvents of 2 lits.
+	const opb = "min: +1 x2 +1 x3 +1 x4 +1 x5 +1 x6 +1 x7 ;\n" +
+		"+1 x1 +1 x2 >= 1 ;\n+1 x1 +1 x3 >= 1 ;\n+1 x1 +1 x4 >= 1 ;\n" +
+		"+1 ~x1 +1 x5 >= 1 ;\n+1 ~x1 +1 x6 >= 1 ;\n+1 ~x1 +1 x7 >= 1 ;\n"
+	tests := []struct {
+		name       string
+		opts       *Options
+		eliminated bool
+	}{
+		{name: "default options", eliminated: false},
+		{name: "grow 3", opts: &Options{Grow: 3}, eliminated: true},
+		{name: "grow 3, resolvents of 1 lit", opts: &Options{Grow: 3, MaxResolventLen: 1}, eliminated: false},
+	}
+	for _, test := range tests {
+		pb, err := ParseOPB(strings.NewReader(opb))
+		if err != nil {
+			t.Fatalf("could not parse problem: %v", err)
+		}
+		pb.Options = test.opts
+		pb.Preprocess()
+		nbClauses := 6
+		if test.eliminated {
+			nbClauses = 9
+		}
+		if len(pb.Clauses) != nbClauses {
+			t.Errorf("%s: expected %d clauses, got %d:\n%s", test.name, nbClauses, len(pb.Clauses), pb.PBString())
+		}
+	}
+}
+
+func TestSubsumeAndStrengthen(t *testing.T) {
+	tests := []struct {
+		name   string
+		knf    string
+		status Status
+		want   string // Expected KNF output, if the problem is not UNSAT
+	}{
+		{ // (1 2) subsumes (1 2 3) and strengthens (-1 2 4) into (2 4), which then subsumes (2 3 4)
+			name:   "subsumption and strengthening",
+			knf:    "p knf 4 4\n1 2 0\n1 2 3 0\n-1 2 4 0\n2 3 4 0\n",
+			status: Indet,
+			want:   "p knf 4 2\n1 2 0\n2 4 0\n",
+		},
+		{ // (1 2) and (1 -2) yield the unit 1, whose propagation turns (-1 3 4) into (3 4),
+			// which only subsumes (3 4 5) in the next round
+			name:   "unit propagated between rounds",
+			knf:    "p knf 5 4\n1 2 0\n1 -2 0\n-1 3 4 0\n3 4 5 0\n",
+			status: Indet,
+			want:   "p knf 5 2\n1 0\n3 4 0\n",
+		},
+		{
+			name:   "unit conflicting with a clause",
+			knf:    "p knf 2 3\n1 2 0\n1 -2 0\n-1 0\n",
+			status: Unsat,
+		},
+	}
+	for _, test := range tests {
+		pb, err := ParseKNF(strings.NewReader(test.knf))
+		if err != nil {
+			t.Fatalf("could not parse problem: %v", err)
+		}
+		pb.subsumeAndStrengthen()
+		if pb.Status != test.status {
+			t.Errorf("%s: expected status %v, got %v", test.name, test.status, pb.Status)
+		} else if test.status != Unsat {
+			if got := pb.KNF(); got != test.want {
+				t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+			}
+		}
+	}
+}
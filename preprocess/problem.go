@@ -1,9 +1,5 @@
 package preprocess
 
-import (
-	"fmt"
-)
-
 // A Problem is a list of clauses & a nb of vars.
 type Problem struct {
 	NbVars     int        // Total nb of vars
@@ -13,6 +9,24 @@ type Problem struct {
 	Model      []decLevel // For each var, its inferred binding. 0 means unbound, 1 means bound to true, -1 means bound to false.
 	minLits    []Lit      // For an optimisation problem, the list of lits whose sum must be minimized
 	minWeights []int      // For an optimisation problem, the weight of each lit.
+	Options    *Options   // Settings of the preprocessing. If nil, DefaultOptions are used.
+}
+
+// Options are the settings of variable elimination, with the same meaning as in the Preprocessor package.
+type Options struct {
+	Grow            int // Variable elimination can add at most this many clauses more than it removes
+	MaxResolventLen int // Vars are not eliminated if it yields a longer resolvent. If 0, there is no limit.
+}
+
+// DefaultOptions are the options used when a problem has no options.
+var DefaultOptions = Options{Grow: 0, MaxResolventLen: 20}
+
+// options returns the options of pb.
+func (pb *Problem) options() *Options {
+	if pb.Options == nil {
+		return &DefaultOptions
+	}
+	return pb.Options
 }
 
 // Optim returns true iff pb is an optimisation problem, ie
@@ -22,33 +36,14 @@ func (pb *Problem) Optim() bool {
 	return pb.minLits != nil
 }
 
-// CNF returns a DIMACS CNF representation of the problem.
+// CNF returns a DIMACS CNF representation of the problem, as written by WriteDIMACS.
 func (pb *Problem) CNF() string {
-	res := fmt.Sprintf("p cnf %d %d\n", pb.NbVars, len(pb.Clauses)+len(pb.Units))
-	for _, unit := range pb.Units {
-		res += fmt.Sprintf("%d 0\n", unit.Int())
-	}
-	for _, clause := range pb.Clauses {
-		res += fmt.Sprintf("%s\n", clause.CNF())
-	}
-	return res
+	return toString(pb.WriteDIMACS)
 }
 
-// PBString returns a representation of the problem as a pseudo-boolean problem.
+// PBString returns a representation of the problem as a pseudo-boolean problem, as written by WriteOPB.
 func (pb *Problem) PBString() string {
-	res := pb.costFuncString()
-	for _, unit := range pb.Units {
-		sign := ""
-		if !unit.IsPositive() {
-			sign = "~"
-			unit = unit.Negation()
-		}
-		res += fmt.Sprintf("1 %sx%d = 1 ;\n", sign, unit.Int())
-	}
-	for _, clause := range pb.Clauses {
-		res += fmt.Sprintf("%s\n", clause.PBString())
-	}
-	return res
+	return toString(pb.WriteOPB)
 }
 
 // SetCostFunc sets the function to minimize when optimizing the problem.
@@ -62,34 +57,6 @@ func (pb *Problem) SetCostFunc(lits []Lit, weights []int) {
 	pb.minWeights = weights
 }
 
-// costFuncString returns a string representation of the cost function of the problem, if any, followed by a \n.
-// If there is no cost function, the empty string will be returned.
-func (pb *Problem) costFuncString() string {
-	if pb.minLits == nil {
-		return ""
-	}
-	res := "min: "
-	for i, lit := range pb.minLits {
-		w := 1
-		if pb.minWeights != nil {
-			w = pb.minWeights[i]
-		}
-		sign := ""
-		if w >= 0 && i != 0 { // No plus sign for the first term or for negative terms.
-			sign = "+"
-		}
-		val := lit.Int()
-		neg := ""
-		if val < 0 {
-			val = -val
-			neg = "~"
-		}
-		res += fmt.Sprintf("%s%d %sx%d", sign, w, neg, val)
-	}
-	res += " ;\n"
-	return res
-}
-
 func (pb *Problem) updateStatus(nbClauses int) {
 	pb.Clauses = pb.Clauses[:nbClauses]
 	if pb.Status == Indet && nbClauses == 0 {
@@ -216,11 +183,18 @@ func (pb *Problem) simplifyCard() {
 						clauseSat = true
 						break
 					}
+					// A true lit is removed, and the remaining lits need one less true lit
+					nbLits--
+					c.Set(j, c.Get(nbLits))
 				} else {
 					nbLits--
 					c.Set(j, c.Get(nbLits))
 				}
 			}
+			if !clauseSat && nbSat != 0 {
+				card -= nbSat
+				c.updateCardinality(-nbSat)
+			}
 			if clauseSat {
 				nbClauses--
 				pb.Clauses[i] = pb.Clauses[nbClauses]
@@ -0,0 +1,146 @@
+package preprocess
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// formulaWriter is a buffered writer with helpers to write DIMACS-like and OPB lines.
+// Errors are sticky in a bufio.Writer, so they are only checked when the buffer is flushed.
+type formulaWriter struct {
+	*bufio.Writer
+	buf []byte // Scratch buffer used to format ints without allocating
+}
+
+func newFormulaWriter(w io.Writer) *formulaWriter {
+	return &formulaWriter{Writer: bufio.NewWriterSize(w, 64*1024)}
+}
+
+// int writes i in decimal.
+func (fw *formulaWriter) int(i int64) {
+	fw.buf = strconv.AppendInt(fw.buf[:0], i, 10)
+	fw.Write(fw.buf)
+}
+
+// header writes a "p <format> nbvars nbclauses" line.
+func (fw *formulaWriter) header(format string, nbVars, nbClauses int) {
+	fw.WriteString("p ")
+	fw.WriteString(format)
+	fw.WriteByte(' ')
+	fw.int(int64(nbVars))
+	fw.WriteByte(' ')
+	fw.int(int64(nbClauses))
+	fw.WriteByte('\n')
+}
+
+// lits writes the given lits followed by " 0\n".
+func (fw *formulaWriter) lits(lits []Lit) {
+	for _, lit := range lits {
+		fw.int(int64(lit.Int()))
+		fw.WriteByte(' ')
+	}
+	fw.WriteString("0\n")
+}
+
+// term writes the OPB term "weight [~]x<var>".
+func (fw *formulaWriter) term(weight int, lit Lit) {
+	fw.int(int64(weight))
+	fw.WriteByte(' ')
+	if !lit.IsPositive() {
+		fw.WriteByte('~')
+	}
+	fw.WriteByte('x')
+	fw.int(int64(lit.Var()) + 1)
+}
+
+// toString returns what write writes.
+func toString(write func(io.Writer) error) string {
+	var sb strings.Builder
+	write(&sb) // Writing to a strings.Builder never fails
+	return sb.String()
+}
+
+// WriteDIMACS writes a DIMACS CNF representation of the problem to w.
+// It panics if the problem contains cardinality or PB constraints, since they cannot be represented in DIMACS:
+// EncodeCards must be called first.
+func (pb *Problem) WriteDIMACS(w io.Writer) error {
+	fw := newFormulaWriter(w)
+	fw.header("cnf", pb.NbVars, len(pb.Clauses)+len(pb.Units))
+	for _, unit := range pb.Units {
+		fw.lits([]Lit{unit})
+	}
+	for _, c := range pb.Clauses {
+		if c.PseudoBoolean() || c.Cardinality() > 1 {
+			panic("cardinality and PB constraints cannot be represented in DIMACS")
+		}
+		fw.lits(c.lits)
+	}
+	return fw.Flush()
+}
+
+// WriteOPB writes a representation of the problem as a pseudo-boolean problem to w.
+func (pb *Problem) WriteOPB(w io.Writer) error {
+	fw := newFormulaWriter(w)
+	if pb.minLits != nil {
+		fw.WriteString("min: ")
+		for i, lit := range pb.minLits {
+			w := 1
+			if pb.minWeights != nil {
+				w = pb.minWeights[i]
+			}
+			if i != 0 { // Terms are separated by a space, no plus sign for the first term or for negative terms.
+				fw.WriteByte(' ')
+				if w >= 0 {
+					fw.WriteByte('+')
+				}
+			}
+			fw.term(w, lit)
+		}
+		fw.WriteString(" ;\n")
+	}
+	for _, unit := range pb.Units {
+		fw.term(1, unit)
+		fw.WriteString(" = 1 ;\n")
+	}
+	for _, c := range pb.Clauses {
+		for i, lit := range c.lits {
+			if i != 0 {
+				fw.WriteString(" +")
+			}
+			weight := 1
+			if c.pbData != nil {
+				weight = c.pbData.weights[i]
+			}
+			fw.term(weight, lit)
+		}
+		fw.WriteString(" >= ")
+		fw.int(int64(c.Cardinality()))
+		fw.WriteString(" ;\n")
+	}
+	return fw.Flush()
+}
+
+// WriteKNF writes a KNF representation of the problem to w.
+// Clauses are written as regular DIMACS clauses and cardinality constraints as "k" lines.
+// It panics if the problem contains PB constraints, since they cannot be represented in KNF.
+func (pb *Problem) WriteKNF(w io.Writer) error {
+	fw := newFormulaWriter(w)
+	fw.header("knf", pb.NbVars, len(pb.Clauses)+len(pb.Units))
+	for _, unit := range pb.Units {
+		fw.lits([]Lit{unit})
+	}
+	for _, c := range pb.Clauses {
+		if c.PseudoBoolean() {
+			panic("PB constraints cannot be represented in KNF")
+		}
+		if card := c.Cardinality(); card > 1 {
+			fw.WriteString("k ")
+			fw.int(int64(card))
+			fw.WriteByte(' ')
+		}
+		fw.lits(c.lits)
+	}
+	return fw.Flush()
+}
@@ -0,0 +1,53 @@
+package preprocess
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteDIMACS(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		encode bool   // Should cardinality constraints be encoded before writing?
+		panics bool   // Should writing panic?
+		want   string // Expected DIMACS output, if not empty
+	}{
+		{
+			name:  "clauses",
+			input: "p knf 3 2\n1 -2 0\n2 3 0\n",
+			want:  "p cnf 3 2\n1 -2 0\n2 3 0\n",
+		},
+		{
+			name:   "cardinality constraint",
+			input:  "p knf 3 1\nk 2 1 2 3 0\n",
+			panics: true,
+		},
+		{
+			name:   "encoded cardinality constraint",
+			input:  "p knf 3 1\nk 2 1 2 3 0\n",
+			encode: true,
+		},
+	}
+	for _, test := range tests {
+		pb, err := ParseKNF(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("%s: unexpected error %q", test.name, err.Error())
+			continue
+		}
+		if test.encode {
+			pb.EncodeCards()
+		}
+		var got string
+		panicked := func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			got = pb.CNF()
+			return false
+		}()
+		if panicked != test.panics {
+			t.Errorf("%s: expected panic %t, got %t", test.name, test.panics, panicked)
+		} else if test.want != "" && got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}